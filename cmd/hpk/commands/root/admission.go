@@ -17,24 +17,35 @@ package root
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"time"
 
+	"github.com/carv-ics-forth/hpk/compute/metrics"
+	"github.com/carv-ics-forth/hpk/pkg/logging"
+	"github.com/carv-ics-forth/hpk/pkg/portforward"
 	"github.com/carv-ics-forth/hpk/provider"
+	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 	kwhhttp "github.com/slok/kubewebhook/v2/pkg/http"
-	kwhlogrus "github.com/slok/kubewebhook/v2/pkg/log/logrus"
 	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
 	"github.com/virtual-kubelet/virtual-kubelet/node/api"
 	corev1 "k8s.io/api/core/v1"
 )
 
+const (
+	// streamIdleTimeout is the maximum time a streaming connection can be idle, as the default of the Kubelet.
+	streamIdleTimeout = 4 * time.Hour
+
+	// streamCreationTimeout is the maximum time for the streams of a connection to be created.
+	streamCreationTimeout = 30 * time.Second
+)
+
 func AddAdmissionWebhooks(c Opts, virtualk8s *provider.VirtualK8S) {
-	logrusLogEntry := logrus.NewEntry(logrus.New())
-	logrusLogEntry.Logger.SetLevel(logrus.DebugLevel)
-	logger := kwhlogrus.NewLogrus(logrusLogEntry)
+	logger := logging.Webhook(DefaultLogger.WithName("webhook"))
 
-	mux := http.NewServeMux()
+	serveMux := http.NewServeMux()
 
 	/*---------------------------------------------------
 	 * Mutate CRDs before they arrive to Virtual-Kubelet
@@ -56,7 +67,7 @@ func AddAdmissionWebhooks(c Opts, virtualk8s *provider.VirtualK8S) {
 			panic(fmt.Errorf("error creating webhook handler: %w", err))
 		}
 
-		mux.Handle("/mutates/pod", podMutator)
+		serveMux.Handle("/mutates/pod", podMutator)
 	}
 
 	{ // PVC Mutator
@@ -76,27 +87,75 @@ func AddAdmissionWebhooks(c Opts, virtualk8s *provider.VirtualK8S) {
 			panic(fmt.Errorf("error creating webhook handler: %w", err))
 		}
 
-		mux.Handle("/mutates/pvc", pvcMutator)
+		serveMux.Handle("/mutates/pvc", pvcMutator)
 	}
 
-	mux.Handle("/hello", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+	serveMux.Handle("/hello", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		writer.Write([]byte("Hi there! I 'm HPK-Kubelet. My job is to run your Kubernetes stuff on Slurm.\n"))
 	}))
 
 	/*---------------------------------------------------
 	 * Add handlers for Logs and Statistics
 	 *---------------------------------------------------*/
+	{ // Attach and PortForward are not routed by Virtual-Kubelet. Attach shares the streaming protocol of Exec.
+		router := mux.NewRouter()
+		router.StrictSlash(true)
+
+		router.HandleFunc("/attach/{namespace}/{pod}/{container}",
+			api.HandleContainerExec(func(ctx context.Context, namespace, pod, container string, _ []string, attach api.AttachIO) error {
+				return virtualk8s.AttachToContainer(ctx, namespace, pod, container, attach)
+			},
+				api.WithExecStreamIdleTimeout(streamIdleTimeout),
+				api.WithExecStreamCreationTimeout(streamCreationTimeout),
+			),
+		).Methods("POST", "GET")
+
+		router.HandleFunc("/portForward/{namespace}/{pod}", func(w http.ResponseWriter, req *http.Request) {
+			vars := mux.Vars(req)
+
+			portforward.ServePortForward(w, req, func(ctx context.Context, port int32, stream io.ReadWriteCloser) error {
+				return virtualk8s.PortForward(ctx, vars["namespace"], vars["pod"], port, stream)
+			}, streamIdleTimeout, streamCreationTimeout)
+		}).Methods("POST", "GET")
+
+		serveMux.Handle("/attach/", api.InstrumentHandler(router))
+		serveMux.Handle("/portForward/", api.InstrumentHandler(router))
+	}
+
 	api.AttachPodRoutes(api.PodHandlerConfig{
 		RunInContainer:   virtualk8s.RunInContainer,
 		GetContainerLogs: virtualk8s.GetContainerLogs,
 		GetPods:          virtualk8s.GetPods,
+		GetStatsSummary:  virtualk8s.GetStatsSummary,
 		// GetPodsFromKubernetes: func(context.Context) ([]*corev1.Pod, error) {
 		//	return k8sclientset.CoreV1().Pods(c.KubeNamespace).List(ctx, labels.Everything())
 		// },
-		// GetStatsSummary:       virtualk8s.GetStatsSummary,
-		// StreamIdleTimeout:     0,
-		// StreamCreationTimeout: 0,
-	}, mux, true)
+		StreamIdleTimeout:     streamIdleTimeout,
+		StreamCreationTimeout: streamCreationTimeout,
+	}, serveMux, true)
+
+	/*---------------------------------------------------
+	 * Add handlers for Prometheus metrics
+	 *---------------------------------------------------*/
+	serveMux.Handle("/metrics", metrics.Handler())
+	serveMux.Handle("/metrics/resource", virtualk8s.ResourceMetricsHandler())
+	serveMux.Handle("/metrics/cadvisor", virtualk8s.CadvisorMetricsHandler())
+
+	// The metrics are also served over plain HTTP, for scrapers without the credentials of the API server.
+	if c.MetricsPort > 0 {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		metricsMux.Handle("/metrics/resource", virtualk8s.ResourceMetricsHandler())
+		metricsMux.Handle("/metrics/cadvisor", virtualk8s.CadvisorMetricsHandler())
+
+		go func() {
+			if err := http.ListenAndServe(fmt.Sprintf(":%d", c.MetricsPort), metricsMux); err != nil {
+				DefaultLogger.Error(err, "Metrics Server has failed")
+
+				os.Exit(1)
+			}
+		}()
+	}
 
 	/*---------------------------------------------------
 	 * Start the Webhook on the background
@@ -109,10 +168,11 @@ func AddAdmissionWebhooks(c Opts, virtualk8s *provider.VirtualK8S) {
 			allAddr,
 			c.K8sAPICertFilepath,
 			c.K8sAPIKeyFilepath,
-			mux,
+			serveMux,
 		); err != nil && !errors.Is(err, context.Canceled) {
-			logrus.Fatal("API Server has failed. Err:", err)
-			// handle error
+			DefaultLogger.Error(err, "API Server has failed")
+
+			os.Exit(1)
 		}
 	}()
 
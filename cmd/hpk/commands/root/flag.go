@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/image"
 	"github.com/spf13/pflag"
 	corev1 "k8s.io/api/core/v1"
 )
@@ -38,7 +39,11 @@ type Opts struct {
 	// KubeletPorts determines the port to listen for requests from the Kubernetes API server.
 	KubeletPort int32
 
-	// MetricsPort int32
+	// MetricsPort determines the port to serve the Prometheus metrics over plain HTTP. Zero disables it.
+	MetricsPort int32
+
+	// TraceEndpoint is the OTLP/HTTP collector where the traces of pods are exported. Empty disables tracing.
+	TraceEndpoint string
 
 	K8sAPICertFilepath string
 	K8sAPIKeyFilepath  string
@@ -51,6 +56,12 @@ type Opts struct {
 
 	FSPollingInterval time.Duration
 
+	// ContainerLogMaxSize is a quantity (e.g, 10Mi) that is parsed into the ContainerLogMaxSize of the host environment.
+	ContainerLogMaxSize string
+
+	// ImageGC configures the garbage collection of the images that are no longer used by pods.
+	ImageGC image.GCPolicy
+
 	// Number of workers to use to handle pod notifications
 	PodSyncWorkers       int
 	InformerResyncPeriod time.Duration
@@ -68,6 +79,7 @@ const (
 	EnvKubeletAddress  = "VKUBELET_ADDRESS"
 	EnvAPICertLocation = "APISERVER_CERT_LOCATION"
 	EnvAPIKeyLocation  = "APISERVER_KEY_LOCATION"
+	EnvTraceEndpoint   = "OTEL_EXPORTER_OTLP_ENDPOINT"
 )
 
 func installFlags(flags *pflag.FlagSet, c *Opts) {
@@ -75,7 +87,8 @@ func installFlags(flags *pflag.FlagSet, c *Opts) {
 	flags.StringVar(&c.KubeletAddress, "kubelet-addr", os.Getenv(EnvKubeletAddress), "which address to tell API server to use")
 	flags.Int32Var(&c.KubeletPort, "kubelet-port", 10250, "port to listen for incoming requests from API server")
 
-	// flags.Int32Var(&c.MetricsPort, "metrics-port", 10255, "address to listen for metrics/stats requests")
+	flags.Int32Var(&c.MetricsPort, "metrics-port", 0, "port to serve Prometheus metrics over plain HTTP (0 disables it)")
+	flags.StringVar(&c.TraceEndpoint, "trace-endpoint", os.Getenv(EnvTraceEndpoint), "OTLP/HTTP collector to export traces (e.g, http://localhost:4318). Empty disables tracing.")
 
 	flags.StringVar(&c.K8sAPICertFilepath, "certificate", os.Getenv(EnvAPICertLocation), "location for certificate to the API server")
 	flags.StringVar(&c.K8sAPIKeyFilepath, "key", os.Getenv(EnvAPIKeyLocation), "location for key for the API server")
@@ -84,7 +97,9 @@ func installFlags(flags *pflag.FlagSet, c *Opts) {
 	flags.StringVar(&c.NodeName, "nodename", "hpk-kubelet", "kubernetes node name")
 
 	flags.StringVar(&c.DefaultHostEnvironment.PodmanBin, "podman", "podman-hpc", "path to Podman bin")
-	flags.StringVar(&c.DefaultHostEnvironment.ContainerRegistry, "registry", "docker://", "container registry")
+	flags.StringVar(&c.DefaultHostEnvironment.ContainerRegistry, "registry", "", "mirror of docker.io (e.g, harbor.local/dockerhub). Shorthand for --image-rewrite 'docker.io/*=<registry>/*'")
+	flags.StringArrayVar(&c.DefaultHostEnvironment.ImageRewriteRules, "image-rewrite", nil, "rule to pull images from another registry (e.g, 'docker.io/*=harbor.local/dockerhub/*'). The first matching rule applies. Can be repeated.")
+	flags.BoolVar(&c.DefaultHostEnvironment.RewritePodImages, "rewrite-pod-images", false, "rewrite the images of pods upon admission, so that their status shows the images that are actually pulled")
 	flags.StringVar(&c.DefaultHostEnvironment.WorkingDirectory, "working-dir", GetUserHomeDir(), "sets up the HPK's working directory")
 	// Set up config filepath for Slurm
 	// flags.StringVar(&c.DefaultHostEnvironment.SlurmConfigFilePath, "/config.json", , "sets up the HPK's working directory")
@@ -92,6 +107,14 @@ func installFlags(flags *pflag.FlagSet, c *Opts) {
 	flags.BoolVar(&c.DefaultHostEnvironment.EnableCgroupV2, "enable-cgroupv2", false, "Enable support for cgroupv2.")
 	flags.DurationVar(&c.FSPollingInterval, "poll", 5*time.Second, "if greater than 0, it will use a poll based approach to watch for file system changes")
 
+	flags.StringVar(&c.ContainerLogMaxSize, "container-log-max-size", "10Mi", "maximum size of a container log file before it is rotated. Zero disables the rotation.")
+	flags.IntVar(&c.DefaultHostEnvironment.ContainerLogMaxFiles, "container-log-max-files", 5, "maximum number of log files that are kept per container, including the current one.")
+
+	flags.IntVar(&c.ImageGC.HighThresholdPercent, "image-gc-high-threshold", 100, "percent of disk usage of the filesystem that holds the image store of the runtime, after which image garbage collection is always run. The usage includes all the files of the filesystem (e.g, of other users on a shared filesystem). 100 disables it.")
+	flags.IntVar(&c.ImageGC.LowThresholdPercent, "image-gc-low-threshold", 80, "percent of disk usage of the filesystem that holds the image store of the runtime, that image garbage collection attempts to free to.")
+	flags.DurationVar(&c.ImageGC.MinAge, "image-minimum-gc-age", 2*time.Minute, "minimum age for an unused image before it is garbage collected")
+	flags.DurationVar(&c.ImageGC.MaxAge, "image-maximum-gc-age", 0, "maximum age an image can be unused before it is garbage collected. Zero disables it.")
+
 	flags.IntVar(&c.PodSyncWorkers, "pod-sync-workers", 1, `set the number of pod synchronization workers`)
 	flags.DurationVar(&c.InformerResyncPeriod, "full-resync-period", 0, "how often to perform a full resync of pods between kubernetes and the provider")
 
@@ -24,14 +24,17 @@ import (
 
 	"github.com/carv-ics-forth/hpk/cmd/hpk/commands"
 	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/image"
+	"github.com/carv-ics-forth/hpk/compute/tracing"
 	"github.com/hashicorp/go-multierror"
-	"github.com/sirupsen/logrus"
 	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
 	vklog "github.com/virtual-kubelet/virtual-kubelet/log"
 	"github.com/virtual-kubelet/virtual-kubelet/log/klogv2"
 	"golang.org/x/time/rate"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -91,6 +94,10 @@ func NewCommand(ctx context.Context, name string, c Opts) *cobra.Command {
 				merr = multierror.Append(merr, errors.Errorf("empty key path. Use flags or set %s", EnvAPIKeyLocation))
 			}
 
+			if err := c.ImageGC.Validate(); err != nil {
+				merr = multierror.Append(merr, err)
+			}
+
 			if merr.ErrorOrNil() != nil {
 				return merr.ErrorOrNil()
 			}
@@ -112,7 +119,8 @@ var DefaultLogger = zap.New(zap.UseDevMode(true))
 // https://medium.com/microsoftazure/virtual-kubelet-turns-1-0-deep-dive-b64056061b18
 func runRootCommand(ctx context.Context, c Opts) error {
 	/*--
-	Don't ask .... Just believe that this is the only way to dump logs from the virtual kubelet to the terminal
+	Don't ask .... Just believe that this is the only way to dump logs from the virtual kubelet to the terminal.
+	klog writes into the logger of HPK (see logging.Install).
 	*/
 	vklog.L = klogv2.New(vklog.Fields{})
 
@@ -143,6 +151,21 @@ func runRootCommand(ctx context.Context, c Opts) error {
 
 		compute.Environment = c.DefaultHostEnvironment
 
+		logMaxSize, err := resource.ParseQuantity(c.ContainerLogMaxSize)
+		if err != nil {
+			return errors.Wrapf(err, "invalid container-log-max-size '%s'", c.ContainerLogMaxSize)
+		}
+		compute.Environment.ContainerLogMaxSize = logMaxSize.Value()
+
+		if compute.Environment.ContainerLogMaxFiles < 1 {
+			return errors.Errorf("container-log-max-files must be at least 1, got '%d'", compute.Environment.ContainerLogMaxFiles)
+		}
+
+		image.Rewrites, err = image.NewRewriteRules(compute.Environment.ImageRewriteRules, compute.Environment.ContainerRegistry)
+		if err != nil {
+			return errors.Wrapf(err, "invalid image rewrite rules")
+		}
+
 		kubemaster, err := url.Parse(restConfig.Host)
 		if err != nil {
 			return errors.Wrapf(err, "failed to extract hostname from url '%s'", restConfig.Host)
@@ -152,9 +175,32 @@ func runRootCommand(ctx context.Context, c Opts) error {
 		DefaultLogger.Info("KubeClient is ready",
 			"Address", restConfig.Host,
 			"ContainerRegistry", compute.Environment.ContainerRegistry,
+			"ImageRewriteRules", image.Rewrites,
 		)
 	}
 
+	/*---------------------------------------------------
+	 * Export traces to the OpenTelemetry collector
+	 *---------------------------------------------------*/
+	shutdownTracing, err := tracing.Setup(c.TraceEndpoint, commands.BuildVersion)
+	if err != nil {
+		return errors.Wrapf(err, "unable to setup tracing")
+	}
+
+	defer func() {
+		// the main context is already cancelled.
+		flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer flushCancel()
+
+		if err := shutdownTracing(flushCtx); err != nil {
+			DefaultLogger.Error(err, "failed to flush traces")
+		}
+	}()
+
+	if c.TraceEndpoint != "" {
+		DefaultLogger.Info("Tracing is enabled", "endpoint", c.TraceEndpoint)
+	}
+
 	/*---------------------------------------------------
 	 * Discover Kubernetes DNS server
 	 *---------------------------------------------------*/
@@ -183,6 +229,7 @@ func runRootCommand(ctx context.Context, c Opts) error {
 	 * Register the Provisioner of Virtual Nodes
 	 *---------------------------------------------------*/
 	virtualk8s, err := provider.NewVirtualK8S(provider.InitConfig{
+		NodeName:          c.NodeName,
 		InternalIP:        c.KubeletAddress,
 		DaemonPort:        c.KubeletPort,
 		BuildVersion:      commands.BuildVersion,
@@ -195,6 +242,18 @@ func runRootCommand(ctx context.Context, c Opts) error {
 
 	AddAdmissionWebhooks(c, virtualk8s)
 
+	/*---------------------------------------------------
+	 * Remove the Images that are no longer Used
+	 *---------------------------------------------------*/
+	go image.RunGarbageCollector(ctx, compute.HPK.ImageDir(), c.ImageGC, provider.ImagesInUse)
+
+	DefaultLogger.Info("Image garbage collector is ready",
+		"highThresholdPercent", c.ImageGC.HighThresholdPercent,
+		"lowThresholdPercent", c.ImageGC.LowThresholdPercent,
+		"minAge", c.ImageGC.MinAge,
+		"maxAge", c.ImageGC.MaxAge,
+	)
+
 	DefaultLogger.Info("Virtual Node Provisioner is ready",
 		"Address", virtualk8s.InternalIP,
 		"DaemonPort", virtualk8s.DaemonPort,
@@ -216,12 +275,15 @@ func runRootCommand(ctx context.Context, c Opts) error {
 			})
 
 		eb := record.NewBroadcaster()
-		eb.StartLogging(logrus.Infof)
+		eb.StartStructuredLogging(0)
+		eb.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: compute.K8SClientset.CoreV1().Events("")})
+
+		compute.EventRecorder = eb.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "hpk-controller"})
 
 		pc, err := node.NewPodController(node.PodControllerConfig{
 			PodClient:                            compute.K8SClientset.CoreV1(),
 			PodInformer:                          podInformer,
-			EventRecorder:                        eb.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "hpk-controller"}),
+			EventRecorder:                        compute.EventRecorder,
 			Provider:                             virtualk8s,
 			ConfigMapInformer:                    configMapInformer,
 			SecretInformer:                       secretInformer,
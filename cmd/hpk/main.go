@@ -24,8 +24,9 @@ import (
 
 	"github.com/carv-ics-forth/hpk/cmd/hpk/commands"
 	"github.com/carv-ics-forth/hpk/cmd/hpk/commands/root"
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/pkg/logging"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 )
@@ -83,7 +84,7 @@ func main() {
 	rootCmd.AddCommand(NewVersionCommand(commands.BuildVersion, commands.BuildTime), NewRootCommand())
 	preRun := rootCmd.PreRunE
 
-	var logLevel string
+	var logLevel, logFormat string
 	rootCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
 		if preRun != nil {
 			return preRun(cmd, args)
@@ -93,17 +94,20 @@ func main() {
 	}
 
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", `set the log level, e.g. "debug", "info", "warn", "error"`)
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logging.FormatText, `set the log format, "text" or "json"`)
 
 	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
-		
-		if logLevel != "" {
-			lvl, err := logrus.ParseLevel(logLevel)
-			if err != nil {
-				return errors.Wrap(err, "could not parse log level")
-			}
-			logrus.SetLevel(lvl)
+		logger, err := logging.New(logLevel, logFormat)
+		if err != nil {
+			return errors.Wrap(err, "could not setup logging")
 		}
 
+		/*-- the same logger for HPK and for the libraries (virtual-kubelet, client-go, kubewebhook) --*/
+		logging.Install(logger)
+
+		compute.DefaultLogger = logger
+		root.DefaultLogger = logger
+
 		return nil
 	}
 
@@ -46,6 +46,15 @@ const (
 
 	// ExtensionJobID describes the file  where the sbatch script will write its job id.
 	ExtensionJobID ControlFileType = ".jobid"
+
+	// ExtensionOOMKilled describes the file where the sbatch script marks a container killed by the OOM killer.
+	ExtensionOOMKilled ControlFileType = ".oomKilled"
+
+	// ExtensionPreempted describes the file where the sbatch script marks the termination warning of Slurm.
+	ExtensionPreempted ControlFileType = ".preempted"
+
+	// ExtensionCheckpoint describes the file where the sbatch script writes the exit code of the checkpoint command.
+	ExtensionCheckpoint ControlFileType = ".checkpoint"
 )
 
 // Pod-Related Extensions
@@ -58,6 +67,9 @@ const (
 
 	// ExtensionStderr describes the file where the sbatch script will write its stderr.
 	ExtensionStderr = ".stderr"
+
+	// ExtensionHostname describes the file where the sbatch script will write the hostname of its compute node.
+	ExtensionHostname = ".hostname"
 )
 
 // Container-Related Extensions
@@ -67,6 +79,22 @@ const (
 
 	// ExtensionLogs describes the file  where the sbatch script will write its logs.
 	ExtensionLogs = ".logs"
+
+	// ExtensionPreviousLogs describes the file where HPK keeps the logs of the previous run of the container.
+	ExtensionPreviousLogs = ".previous.logs"
+
+	// ExtensionTerminationMessage describes the file where the container will write its termination message.
+	ExtensionTerminationMessage = ".termination-log"
+
+	// ExtensionStdin describes the FIFO where HPK writes the stdin of an interactive container.
+	ExtensionStdin = ".stdin"
+
+	// ExtensionTTY describes the file where the job writes the pseudo-terminal of an interactive container.
+	ExtensionTTY = ".tty"
+
+	// ExtensionStats describes the file where the job writes the samples of resource usage.
+	// It is kept outside the control files, so that the periodic samples do not trigger the notifier.
+	ExtensionStats = ".stats"
 )
 
 type HPKPath string
@@ -91,6 +119,11 @@ func (p HPKPath) CorruptedDir() string {
 	return filepath.Join(string(p), ".corrupted")
 }
 
+// SystemPanicsPath points to the file wherein the number of system panics is kept across restarts.
+func (p HPKPath) SystemPanicsPath() string {
+	return filepath.Join(string(p), ".system_panics")
+}
+
 type WalkPodFunc func(path PodPath) error
 
 func (p HPKPath) WalkPodDirectories(f WalkPodFunc) error {
@@ -255,6 +288,26 @@ func (p PodPath) IPAddressPath() string {
 	return filepath.Join(p.ControlFileDir(), string(ExtensionIP))
 }
 
+// PreemptedPath points $HPK/<namespace>/<podName>/controlfile/.preempted
+func (p PodPath) PreemptedPath() string {
+	return filepath.Join(p.ControlFileDir(), string(ExtensionPreempted))
+}
+
+// CheckpointPath points $HPK/<namespace>/<podName>/controlfile/.checkpoint
+func (p PodPath) CheckpointPath() string {
+	return filepath.Join(p.ControlFileDir(), string(ExtensionCheckpoint))
+}
+
+// HostnamePath points to $HPK/<namespace>/<podName>/job/pod.hostname
+func (p PodPath) HostnamePath() string {
+	return filepath.Join(p.JobDir(), "pod"+ExtensionHostname)
+}
+
+// StatsPath points to $HPK/<namespace>/<podName>/job/pod.stats
+func (p PodPath) StatsPath() string {
+	return filepath.Join(p.JobDir(), "pod"+ExtensionStats)
+}
+
 /*
 	Container-Related paths captured by Slurm Notifier.
 	They are necessary to drive the lifecycle of a Container.
@@ -276,6 +329,11 @@ func (c ContainerPath) LogsPath() string {
 	return filepath.Join(c.p.LogDir(), c.containerName+ExtensionLogs)
 }
 
+// PreviousLogsPath points to the logs of the container before it was restarted.
+func (c ContainerPath) PreviousLogsPath() string {
+	return filepath.Join(c.p.LogDir(), c.containerName+ExtensionPreviousLogs)
+}
+
 func (c ContainerPath) IDPath() string {
 	return filepath.Join(c.p.ControlFileDir(), c.containerName+string(ExtensionJobID))
 }
@@ -284,6 +342,10 @@ func (c ContainerPath) ExitCodePath() string {
 	return filepath.Join(c.p.ControlFileDir(), c.containerName+string(ExtensionExitCode))
 }
 
+func (c ContainerPath) OOMKilledPath() string {
+	return filepath.Join(c.p.ControlFileDir(), c.containerName+string(ExtensionOOMKilled))
+}
+
 /*
 	Container-Related paths not captured by Slurm Notifier.
 	They are needed for HPK to bootstrap a container.
@@ -292,3 +354,23 @@ func (c ContainerPath) ExitCodePath() string {
 func (c ContainerPath) EnvFilePath() string {
 	return filepath.Join(c.p.JobDir(), c.containerName+ExtensionEnvironment)
 }
+
+// StdinPath points to the FIFO that the job binds to the stdin of an interactive container.
+func (c ContainerPath) StdinPath() string {
+	return filepath.Join(c.p.JobDir(), c.containerName+ExtensionStdin)
+}
+
+// TTYPath points to the file where the job writes the pseudo-terminal of an interactive container.
+func (c ContainerPath) TTYPath() string {
+	return filepath.Join(c.p.JobDir(), c.containerName+ExtensionTTY)
+}
+
+// StatsPath points to the file where the job writes the samples of resource usage of the container.
+func (c ContainerPath) StatsPath() string {
+	return filepath.Join(c.p.JobDir(), c.containerName+ExtensionStats)
+}
+
+// TerminationMessagePath is bound to the terminationMessagePath of the container.
+func (c ContainerPath) TerminationMessagePath() string {
+	return filepath.Join(c.p.JobDir(), c.containerName+ExtensionTerminationMessage)
+}
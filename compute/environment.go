@@ -17,15 +17,25 @@ package compute
 import (
 	"github.com/carv-ics-forth/hpk/compute/endpoint"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
 // HostEnvironment containers information about the execution environment.
 type HostEnvironment struct {
-	KubeMasterHost    string
+	KubeMasterHost string
+
+	// ContainerRegistry is the mirror of the default registry (docker.io). Empty disables it.
 	ContainerRegistry string
-	PodmanBin      string
+
+	// ImageRewriteRules redirect images to other registries (e.g, docker.io/*=harbor.local/dockerhub/*).
+	ImageRewriteRules []string
+
+	// RewritePodImages sets the image of containers to the rewritten image, upon admission of the pod.
+	RewritePodImages bool
+
+	PodmanBin string
 
 	EnableCgroupV2 bool
 
@@ -33,6 +43,13 @@ type HostEnvironment struct {
 
 	// KubeDNS points to the internal DNS of a Kubernetes cluster.
 	KubeDNS string
+
+	// ContainerLogMaxSize is the size (in bytes) upon which the job rotates the logs of a container,
+	// and the output of Slurm. Zero disables the rotation.
+	ContainerLogMaxSize int64
+
+	// ContainerLogMaxFiles is the number of log files that are kept per container, including the current one.
+	ContainerLogMaxFiles int
 }
 
 // The VirtualEnvironment create lightweight "virtual environments" that resemble "Pods" semantics.
@@ -49,6 +66,9 @@ type VirtualEnvironment struct {
 	// IPAddressPath is where we store the internal Pod's ip.
 	IPAddressPath string
 
+	// HostnamePath is where we store the hostname of the compute node.
+	HostnamePath string
+
 	// StdoutPath instruct Slurm to write stdout into the specified path.
 	StdoutPath string
 
@@ -57,6 +77,15 @@ type VirtualEnvironment struct {
 
 	// SysErrorFilePath indicate a system failure that cause the Pod to fail Immediately, bypassing any other checks.
 	SysErrorFilePath string
+
+	// PreemptedPath indicates that Slurm has warned the job for its termination, and the Pod is being checkpointed.
+	PreemptedPath string
+
+	// CheckpointPath indicates that the checkpoint is completed, and the job can be resubmitted.
+	CheckpointPath string
+
+	// StatsPath is where the job writes the samples of resource usage of the pod.
+	StatsPath string
 }
 
 // Instantiated Types
@@ -69,5 +98,8 @@ var (
 	K8SClient    client.Client
 	K8SClientset *kubernetes.Clientset
 
+	// EventRecorder publishes Kubernetes Events. Until the controller sets the real recorder, events are dropped.
+	EventRecorder record.EventRecorder = &record.FakeRecorder{}
+
 	HPK endpoint.HPKPath
 )
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"regexp"
 
+	"github.com/carv-ics-forth/hpk/compute/metrics"
 	"github.com/carv-ics-forth/hpk/pkg/crdtools"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
@@ -45,6 +46,8 @@ func PodError(pod *corev1.Pod, reason string, msgFormat string, msgArgs ...any)
 	pod.Status.Reason = reason
 	pod.Status.Message = fmt.Sprintf(msgFormat, msgArgs...)
 
+	metrics.PodErrors.WithLabelValues(reason).Inc()
+
 	crdtools.SetPodStatusCondition(&pod.Status.Conditions, corev1.PodCondition{
 		Type:   corev1.PodReady,
 		Status: corev1.ConditionFalse,
@@ -60,5 +63,7 @@ func SystemPanic(err error, errFormat string, errArgs ...any) {
 
 	DefaultLogger.Error(werr, "SystemERROR")
 
+	metrics.RecordSystemPanic()
+
 	panic(werr)
 }
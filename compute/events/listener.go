@@ -16,14 +16,25 @@ package events
 
 import (
 	"context"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/carv-ics-forth/hpk/compute"
 	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/compute/metrics"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/carv-ics-forth/hpk/compute/tracing"
+	kubecontainer "github.com/carv-ics-forth/hpk/pkg/container"
 	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -36,6 +47,9 @@ import (
 
 var ErrClosedQueue = errors.New("queue is closed")
 
+// maxSysErrorLines is the number of lines from the end of the syserror file that are reported in the pod status.
+const maxSysErrorLines = 10
+
 // Options represent options for SlurmEventHandler.
 type Options struct {
 	MaxWorkers   int // Number of workers to spawn.
@@ -75,12 +89,16 @@ func (h *EventHandler) Push(event fsnotify.Event) {
 	}
 
 	h.Queue <- event
+
+	metrics.EventQueueLength.Set(float64(len(h.Queue)))
 }
 
 type PodControl struct {
 	UpdateStatus         func(pod *corev1.Pod)
 	LoadFromDisk         func(podRef client.ObjectKey) (*corev1.Pod, error)
+	SaveStatus           func(ctx context.Context, pod *corev1.Pod) error
 	NotifyVirtualKubelet func(pod *corev1.Pod)
+	Resubmit             func(ctx context.Context, pod *corev1.Pod)
 }
 
 // Listen spawns workers and listens to the queue
@@ -107,6 +125,8 @@ func (h *EventHandler) Listen(ctx context.Context, control PodControl) {
 
 					return
 				case event := <-h.Queue:
+					metrics.EventQueueLength.Set(float64(len(h.Queue)))
+
 					// filter events other than creations.
 					if !event.Op.Has(fsnotify.Create) {
 						compute.DefaultLogger.Info("SLURM: omit non-create event", "details", event)
@@ -125,6 +145,12 @@ func (h *EventHandler) Listen(ctx context.Context, control PodControl) {
 
 					logger := compute.DefaultLogger.WithValues("pod", podkey)
 
+					// the control files of containers are named after them (e.g, <container>.exitCode).
+					ext := filepath.Ext(file)
+					if ext == endpoint.ExtensionJobID || ext == endpoint.ExtensionExitCode {
+						logger = logger.WithValues("container", strings.TrimSuffix(file, ext))
+					}
+
 					/*-- Skip events that are not related to pod changes driven by Slurm --*/
 					/* In previous versions, this condition was fsnotify.Write, with the goal to avoid race
 					conditions between creating a file and writing a file. However, this does not seem to work
@@ -139,7 +165,10 @@ func (h *EventHandler) Listen(ctx context.Context, control PodControl) {
 					/*---------------------------------------------------
 					 * Declare events that warrant Pod reconciliation
 					 *---------------------------------------------------*/
-					ext := filepath.Ext(file)
+					var podStarted bool
+
+					var spanName string
+
 					switch ext {
 					case endpoint.ExtensionSysError:
 						/*-- Sbatch failed. Pod should fail immediately without other checks --*/
@@ -151,34 +180,82 @@ func (h *EventHandler) Listen(ctx context.Context, control PodControl) {
 							compute.SystemPanic(err, "pod '%s' does not exist", podkey)
 						}
 
+						span := startEventSpan(ctx, pod, "SystemError", file)
+
 						// get failure reason
 						sysErrFile := compute.HPK.Pod(podkey).SysErrorFilePath()
 
-						reason, err := os.ReadFile(sysErrFile)
+						reason, err := kubecontainer.GetTailLog(sysErrFile, maxSysErrorLines)
 						if err != nil {
 							compute.SystemPanic(err, "failed to read file '%s'", sysErrFile)
 						}
 
-						// FIXME: print only the last few lined
-						logger.Info("[SYSERROR]", "details", string(reason))
+						logger.Info("[SYSERROR]", "details", reason)
 
 						// set the pod as failed
-						compute.PodError(pod, "SYSERROR", "Pod creation has failed")
+						if len(reason) > 0 {
+							compute.PodError(pod, "SYSERROR", "Pod creation has failed: %s", strings.Join(reason, "\n"))
+						} else {
+							compute.PodError(pod, "SYSERROR", "Pod creation has failed")
+						}
+
+						compute.EventRecorder.Event(pod, corev1.EventTypeWarning, compute.EventSystemError, pod.Status.Message)
+
+						if !saveStatus(ctx, control, pod, logger) {
+							tracing.EndSpan(span, errors.New(pod.Status.Message))
+
+							continue
+						}
 
 						// update the remote copy
 						control.NotifyVirtualKubelet(pod)
 
+						tracing.EndSpan(span, errors.New(pod.Status.Message))
+
 						continue
 
 					case endpoint.ExtensionIP: // Pod started
 						logger.Info("[Slurm] -> Pod Started", "op", event.Op, "file", file)
 
+						podStarted = true
+						spanName = "PodStarted"
+
 					case endpoint.ExtensionJobID: // Container Started
 						logger.Info("[Slurm] -> Container Started", "op", event.Op, "file", file)
 
+						spanName = "ContainerStarted"
+
 					case endpoint.ExtensionExitCode: // Container Terminated
 						logger.Info("[Slurm] -> Container Terminated", "op", event.Op, "file", file)
 
+						spanName = "ContainerTerminated"
+
+						/*-- Containers terminated by the checkpoint handler will restart with the resubmitted job --*/
+						if _, err := os.Stat(compute.HPK.Pod(podkey).PreemptedPath()); err == nil {
+							logger.Info("Ignore event since Pod is being checkpointed", "file", file)
+
+							continue
+						}
+
+					case endpoint.ExtensionPreempted: // Termination Warning
+						logger.Info("[Slurm] -> Pod Preempted", "op", event.Op, "file", file)
+
+						spanName = "PodPreempted"
+
+					case endpoint.ExtensionCheckpoint: // Checkpoint Completed
+						logger.Info("[Slurm] -> Pod Checkpointed", "op", event.Op, "file", file)
+
+						pod, err := control.LoadFromDisk(podkey)
+						if err != nil {
+							logger.Info("Omit event", "reason", "pod was not found. this is probably a conflict")
+
+							continue
+						}
+
+						control.Resubmit(ctx, pod)
+
+						spanName = "PodCheckpointed"
+
 					default:
 						/*-- Any other file is ignored --*/
 						compute.DefaultLogger.Info("Ignore event", "details", event)
@@ -213,12 +290,28 @@ func (h *EventHandler) Listen(ctx context.Context, control PodControl) {
 						)
 					}
 
+					span := startEventSpan(ctx, pod, spanName, file)
+
+					if podStarted {
+						recordJobStarted(pod)
+					}
+
 					/*-- Recalculate the Pod status from locally stored containers --*/
 					control.UpdateStatus(pod)
 
+					/*-- Keep the status, so that the milestones of the pod are reported once --*/
+					if !saveStatus(ctx, control, pod, logger) {
+						span.End()
+
+						continue
+					}
+
 					/*-- Update the remote Copy --*/
 					control.NotifyVirtualKubelet(pod)
 
+					span.SetAttributes(attribute.String("k8s.pod.phase", string(pod.Status.Phase)))
+					span.End()
+
 					logger.Info("[Slurm] <- Listen for events")
 				}
 			}
@@ -227,3 +320,69 @@ func (h *EventHandler) Listen(ctx context.Context, control PodControl) {
 		waitGroup.Wait()
 	}
 }
+
+// saveStatus persists the recalculated status of the pod. It returns false if the pod has been deleted meanwhile.
+func saveStatus(ctx context.Context, control PodControl, pod *corev1.Pod, logger logr.Logger) bool {
+	if err := control.SaveStatus(ctx, pod); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			logger.Info("Omit event", "reason", "pod was deleted meanwhile")
+
+			return false
+		}
+
+		compute.SystemPanic(err, "failed to persist the status of pod '%s'", client.ObjectKeyFromObject(pod))
+	}
+
+	return true
+}
+
+// startEventSpan starts the span for a Slurm event of the pod, which is linked to the trace that has created the pod.
+func startEventSpan(ctx context.Context, pod *corev1.Pod, name string, file string) trace.Span {
+	attrs := []attribute.KeyValue{attribute.String("hpk.event.file", file)}
+
+	if slurm.HasJobID(pod) {
+		attrs = append(attrs, tracing.AttributeJobID.String(slurm.GetJobID(pod)))
+	}
+
+	_, span := tracing.StartPodEventSpan(ctx, pod, name, attrs...)
+
+	return span
+}
+
+// recordJobStarted emits the Events for a job that has left the Slurm queue, with the time it has waited
+// in the queue and the compute node it has been assigned to.
+func recordJobStarted(pod *corev1.Pod) {
+	podDir := compute.HPK.Pod(client.ObjectKeyFromObject(pod))
+
+	submitted, err := os.Stat(podDir.SubmitJobPath())
+	if err != nil {
+		return
+	}
+
+	started, err := os.Stat(podDir.IPAddressPath())
+	if err != nil {
+		return
+	}
+
+	queueWait := started.ModTime().Sub(submitted.ModTime()).Round(time.Second)
+	if queueWait < 0 {
+		queueWait = 0
+	}
+
+	compute.EventRecorder.Eventf(pod, corev1.EventTypeNormal, compute.EventJobStarted,
+		"Slurm job has started after waiting %s in the queue", queueWait)
+
+	// the hostname is written before the ip, whereas the ip may be empty if the node has no matching address.
+	hostname, err := os.ReadFile(podDir.HostnamePath())
+	if err != nil || len(strings.TrimSpace(string(hostname))) == 0 {
+		return
+	}
+
+	message := fmt.Sprintf("Pod has been assigned to the compute node %s", strings.TrimSpace(string(hostname)))
+
+	if ip, err := os.ReadFile(podDir.IPAddressPath()); err == nil && len(strings.TrimSpace(string(ip))) > 0 {
+		message += fmt.Sprintf(" (IP %s)", strings.TrimSpace(string(ip)))
+	}
+
+	compute.EventRecorder.Event(pod, corev1.EventTypeNormal, compute.EventNodeAssigned, message)
+}
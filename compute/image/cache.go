@@ -0,0 +1,257 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+)
+
+/*
+The images are stored by the runtime (podman-hpc), which shares them with the compute nodes.
+The image directory keeps an index of them, with one record per fully-qualified reference (see Reference.Key),
+that holds the digest of the image and the time it was pulled.
+*/
+
+const recordExtension = ".json"
+
+/*---------------------------------------------------
+ * Index of Cached Images
+ *---------------------------------------------------*/
+
+// RecordPath is the path of the record for the reference in the image directory.
+func RecordPath(imageDir string, ref Reference) string {
+	return filepath.Join(imageDir, ref.Key()+recordExtension)
+}
+
+// LoadRecord returns the cached image for the reference, or fs.ErrNotExist if it is not in the index.
+func LoadRecord(imageDir string, ref Reference) (*Image, error) {
+	encoded, err := os.ReadFile(RecordPath(imageDir, ref))
+	if err != nil {
+		return nil, err
+	}
+
+	var img Image
+	if err := json.Unmarshal(encoded, &img); err != nil {
+		return nil, errors.Wrapf(err, "corrupted record for image '%s'", ref)
+	}
+
+	return &img, nil
+}
+
+// SaveRecord adds the image to the index, replacing any older record for the same reference.
+func SaveRecord(imageDir string, ref Reference, img *Image) error {
+	encoded, err := json.Marshal(img)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode record for image '%s'", ref)
+	}
+
+	// write and rename, so that readers never see partial records.
+	tmp, err := os.CreateTemp(imageDir, ".record-*")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create record for image '%s'", ref)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(encoded); err != nil {
+		tmp.Close()
+
+		return errors.Wrapf(err, "failed to write record for image '%s'", ref)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), endpoint.PodGlobalDirectoryPermissions); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), RecordPath(imageDir, ref))
+}
+
+// RemoveRecord removes the reference from the index. Missing records are ignored.
+func RemoveRecord(imageDir string, ref Reference) error {
+	if err := os.Remove(RecordPath(imageDir, ref)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+/*---------------------------------------------------
+ * Images in the Store of the Runtime
+ *---------------------------------------------------*/
+
+// storedImage is an image in the store of the runtime.
+type storedImage struct {
+	Names  []Reference
+	Digest string
+
+	// ReadOnly images have been migrated by podman-hpc, and are usable from the compute nodes.
+	ReadOnly bool
+}
+
+// storedImagesFormat is the Go template for listing the images of the runtime, one per line.
+const storedImagesFormat = "{{.Names}}|{{.Digest}}|{{.IsReadOnly}}"
+
+func listStoredImages() ([]storedImage, error) {
+	out, err := process.Execute(compute.Environment.PodmanBin, "images", "--format="+storedImagesFormat)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list the images of the runtime")
+	}
+
+	return parseStoredImages(string(out)), nil
+}
+
+// parseStoredImages parses lines as "[docker.io/library/nginx:1.25 localhost/nginx:latest]|sha256:...|true".
+func parseStoredImages(out string) []storedImage {
+	var images []storedImage
+
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.Split(strings.Trim(line, "\" \t"), "|")
+		if len(parts) != 3 {
+			continue
+		}
+
+		img := storedImage{
+			Digest:   strings.TrimSpace(parts[1]),
+			ReadOnly: strings.TrimSpace(parts[2]) == "true",
+		}
+
+		for _, name := range strings.Fields(strings.Trim(parts[0], "[] ")) {
+			// dangling images have no name (<none>).
+			if ref, err := ParseReference(name); err == nil {
+				img.Names = append(img.Names, ref)
+			}
+		}
+
+		images = append(images, img)
+	}
+
+	return images
+}
+
+/*
+matches returns true if the stored image is the one of the reference. References with digest match by content,
+and references with tag match by the exact tag, so that nginx:1.25 never matches a stored nginx:1.19.
+*/
+func (s storedImage) matches(ref Reference) bool {
+	for _, name := range s.Names {
+		if name.Name() != ref.Name() {
+			continue
+		}
+
+		if ref.Digest != "" {
+			if s.Digest == ref.Digest {
+				return true
+			}
+
+			continue
+		}
+
+		if name.Tag == ref.Tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*---------------------------------------------------
+ * Deduplication of Concurrent Pulls
+ *---------------------------------------------------*/
+
+// pullCall is a pull in progress. Callers of the same reference wait for it, and share its result.
+type pullCall struct {
+	done chan struct{}
+	img  *Image
+	err  error
+
+	// waiters is the number of callers that wait for the pull. The pull is cancelled once they all leave.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+var (
+	pullsLock sync.Mutex
+	pulls     = make(map[string]*pullCall)
+)
+
+/*
+singlePull runs pull once for all the concurrent callers with the same key. A caller whose context is cancelled
+stops waiting, but the pull goes on for the rest of the callers. It is cancelled only if no caller waits for it.
+*/
+func singlePull(ctx context.Context, key string, pull func(ctx context.Context) (*Image, error)) (*Image, error) {
+	pullsLock.Lock()
+
+	call, inProgress := pulls[key]
+	if !inProgress {
+		pullCtx, cancel := context.WithCancel(context.Background())
+
+		call = &pullCall{done: make(chan struct{}), cancel: cancel}
+		pulls[key] = call
+
+		go func() {
+			call.img, call.err = pull(pullCtx)
+
+			pullsLock.Lock()
+			if pulls[key] == call {
+				delete(pulls, key)
+			}
+			pullsLock.Unlock()
+
+			cancel()
+			close(call.done)
+		}()
+	}
+
+	call.waiters++
+
+	pullsLock.Unlock()
+
+	select {
+	case <-call.done:
+		return call.img, call.err
+
+	case <-ctx.Done():
+		pullsLock.Lock()
+		defer pullsLock.Unlock()
+
+		call.waiters--
+
+		// later callers start a new pull, rather than joining the cancelled one.
+		if call.waiters == 0 {
+			call.cancel()
+
+			if pulls[key] == call {
+				delete(pulls, key)
+			}
+		}
+
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,159 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_storedImageMatches(t *testing.T) {
+	stored := parseStoredImages(`[docker.io/library/nginx:1.19 localhost/web:latest]|sha256:4b9f2e2c3c7fa1a3e0b2a8b0d2b7c1f3e6a5d4c3b2a190817263544536271809|true
+[<none>]|sha256:0000000000000000000000000000000000000000000000000000000000000000|false
+`)
+
+	if len(stored) != 2 || len(stored[0].Names) != 2 || !stored[0].ReadOnly || len(stored[1].Names) != 0 {
+		t.Fatalf("unexpected images %+v", stored)
+	}
+
+	for image, want := range map[string]bool{
+		"nginx:1.19":              true,
+		"nginx:1.25":              false,
+		"docker.io/library/nginx": false,
+		"localhost/web":           true,
+		"nginx@sha256:4b9f2e2c3c7fa1a3e0b2a8b0d2b7c1f3e6a5d4c3b2a190817263544536271809": true,
+		"nginx@sha256:1111111111111111111111111111111111111111111111111111111111111111": false,
+	} {
+		ref, err := ParseReference(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := stored[0].matches(ref); got != want {
+			t.Errorf("matches(%s) = %v, want %v", image, got, want)
+		}
+	}
+}
+
+func Test_singlePull(t *testing.T) {
+	var calls int32
+
+	release := make(chan struct{})
+
+	pull := func(context.Context) (*Image, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+
+		return &Image{ImageName: "docker.io/library/nginx:1.25"}, nil
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if img, err := singlePull(context.Background(), "nginx", pull); err != nil || img.ImageName != "docker.io/library/nginx:1.25" {
+				t.Errorf("unexpected result %v, %v", img, err)
+			}
+		}()
+	}
+
+	// let the callers join the pull in progress.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected 1 pull, got %d", calls)
+	}
+}
+
+func Test_singlePullCancel(t *testing.T) {
+	pullCancelled := make(chan struct{})
+
+	pull := func(ctx context.Context) (*Image, error) {
+		<-ctx.Done()
+		close(pullCancelled)
+
+		return nil, ctx.Err()
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+
+	results := make(chan error, 2)
+
+	go func() {
+		_, err := singlePull(first, "nginx", pull)
+		results <- err
+	}()
+
+	go func() {
+		_, err := singlePull(second, "nginx", pull)
+		results <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	/*-- the pull goes on while a caller waits for it --*/
+	cancelFirst()
+
+	if err := <-results; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancelled caller to return, got %v", err)
+	}
+
+	select {
+	case <-pullCancelled:
+		t.Fatal("the pull is cancelled while a caller waits for it")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	/*-- the pull is cancelled once no caller waits for it --*/
+	cancelSecond()
+
+	if err := <-results; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancelled caller to return, got %v", err)
+	}
+
+	select {
+	case <-pullCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the pull is not cancelled")
+	}
+}
+
+func Test_pullKey(t *testing.T) {
+	ref, err := ParseReference("harbor.local/project/app:1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anonymous := pullKey(ref, false, "", "")
+	alice := pullKey(ref, true, "alice", "secret")
+
+	for name, key := range map[string]string{
+		"anonymous":      anonymous,
+		"other password": pullKey(ref, true, "alice", "other"),
+		"other user":     pullKey(ref, true, "bob", "secret"),
+		"ambiguous":      pullKey(ref, true, "alice\x00secret", ""),
+	} {
+		if key == alice {
+			t.Errorf("%s: the pull is shared with different credentials", name)
+		}
+	}
+
+	if pullKey(ref, true, "alice", "secret") != alice {
+		t.Error("the pull is not shared with the same credentials")
+	}
+
+	if strings.Contains(alice, "secret") {
+		t.Errorf("the key '%s' exposes the password", alice)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// AuthConfig is the entry of a registry in the Docker configuration (e.g, ~/.docker/config.json).
+type AuthConfig struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// Auth is the base64 encoding of "username:password". It is used if the Username is not set.
+	Auth string `json:"auth,omitempty"`
+}
+
+// Credentials returns the username and password of the registry.
+func (a AuthConfig) Credentials() (username string, password string, err error) {
+	if a.Username != "" {
+		return a.Username, a.Password, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "invalid auth encoding")
+	}
+
+	username, password, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return "", "", errors.Errorf("invalid auth: expected 'username:password'")
+	}
+
+	return username, password, nil
+}
+
+/*
+Keyring maps registries to their credentials, as the "auths" of the Docker configuration.
+The keys are registries (e.g, docker.io, https://index.docker.io/v1/), optionally with a repository
+prefix (e.g, harbor.local/project), which takes precedence over the registry.
+*/
+type Keyring map[string]AuthConfig
+
+// dockerConfigJSON is the payload of kubernetes.io/dockerconfigjson secrets.
+type dockerConfigJSON struct {
+	Auths Keyring `json:"auths"`
+}
+
+// KeyringFromSecret parses the credentials of kubernetes.io/dockerconfigjson and kubernetes.io/dockercfg secrets.
+func KeyringFromSecret(secret *corev1.Secret) (Keyring, error) {
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		var config dockerConfigJSON
+
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+			return nil, errors.Wrapf(err, "invalid '%s' in secret '%s'", corev1.DockerConfigJsonKey, secret.GetName())
+		}
+
+		return config.Auths, nil
+
+	case corev1.SecretTypeDockercfg:
+		var keyring Keyring
+
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &keyring); err != nil {
+			return nil, errors.Wrapf(err, "invalid '%s' in secret '%s'", corev1.DockerConfigKey, secret.GetName())
+		}
+
+		return keyring, nil
+
+	default:
+		return nil, errors.Errorf("secret '%s' has type '%s', expected '%s'",
+			secret.GetName(), secret.Type, corev1.SecretTypeDockerConfigJson)
+	}
+}
+
+// Merge adds the credentials of other. The existing credentials take precedence, as the first pull secret of pods.
+func (k Keyring) Merge(other Keyring) Keyring {
+	if k == nil {
+		k = make(Keyring)
+	}
+
+	for registry, auth := range other {
+		if _, exists := k[registry]; !exists {
+			k[registry] = auth
+		}
+	}
+
+	return k
+}
+
+// Lookup returns the credentials for the reference, from the most specific registry entry that matches it.
+func (k Keyring) Lookup(ref Reference) (AuthConfig, bool) {
+	var (
+		best      AuthConfig
+		bestMatch string
+	)
+
+	for registry, auth := range k {
+		prefix := normalizeRegistry(registry)
+
+		if prefix == ref.Domain || strings.HasPrefix(ref.Name(), prefix+"/") {
+			if len(prefix) > len(bestMatch) {
+				best, bestMatch = auth, prefix
+			}
+		}
+	}
+
+	return best, bestMatch != ""
+}
+
+// normalizeRegistry strips the scheme and API version from the keys of the Docker configuration.
+func normalizeRegistry(registry string) string {
+	if _, withoutScheme, found := strings.Cut(registry, "://"); found {
+		registry = withoutScheme
+	}
+
+	registry = strings.TrimSuffix(registry, "/")
+	registry = strings.TrimSuffix(registry, "/v1")
+	registry = strings.TrimSuffix(registry, "/v2")
+
+	if registry == "index.docker.io" || registry == "registry-1.docker.io" {
+		return DefaultDomain
+	}
+
+	return registry
+}
+
+/*---------------------------------------------------
+ * Credentials of a Single Pull
+ *---------------------------------------------------*/
+
+/*
+writeAuthFile writes the credentials of the registry into a temporary file, in the format of podman --authfile.
+The file is readable only by the user, it is outside the pod directory (which is shared with the compute nodes),
+and it must be removed after the pull.
+*/
+func writeAuthFile(ref Reference, username string, password string) (string, error) {
+	config := dockerConfigJSON{
+		Auths: Keyring{
+			ref.Domain: {Auth: base64.StdEncoding.EncodeToString([]byte(username + ":" + password))},
+		},
+	}
+
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	// CreateTemp creates files with mode 0600.
+	authFile, err := os.CreateTemp("", "hpk-auth-*.json")
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create authfile")
+	}
+
+	if _, err := authFile.Write(encoded); err != nil {
+		authFile.Close()
+		os.Remove(authFile.Name())
+
+		return "", errors.Wrapf(err, "failed to write authfile")
+	}
+
+	if err := authFile.Close(); err != nil {
+		os.Remove(authFile.Name())
+
+		return "", err
+	}
+
+	return authFile.Name(), nil
+}
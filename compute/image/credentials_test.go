@@ -0,0 +1,90 @@
+package image
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestKeyringFromSecret(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "regcred"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(`{"auths": {
+				"https://index.docker.io/v1/": {"auth": "dXNlcjpodWI="},
+				"harbor.local": {"username": "robot", "password": "registry"},
+				"harbor.local/private": {"username": "robot", "password": "project"}
+			}}`),
+		},
+	}
+
+	keyring, err := KeyringFromSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for image, wantPassword := range map[string]string{
+		"busybox":                   "hub",
+		"harbor.local/public/nginx": "registry",
+		"harbor.local/private/app":  "project",
+		"quay.io/jetstack/cert":     "",
+	} {
+		ref, err := ParseReference(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		auth, found := keyring.Lookup(ref)
+		if found != (wantPassword != "") {
+			t.Errorf("Lookup(%s) found = %v", image, found)
+
+			continue
+		}
+
+		if !found {
+			continue
+		}
+
+		if _, password, err := auth.Credentials(); err != nil || password != wantPassword {
+			t.Errorf("Lookup(%s) password = %s (%v), want %s", image, password, err, wantPassword)
+		}
+	}
+
+	if _, err := KeyringFromSecret(&corev1.Secret{Type: corev1.SecretTypeOpaque}); err == nil {
+		t.Error("expected error for opaque secret")
+	}
+}
+
+func TestWriteAuthFile(t *testing.T) {
+	ref, _ := ParseReference("harbor.local/private/app:1.0")
+
+	authFile, err := writeAuthFile(ref, "robot", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(authFile)
+
+	info, err := os.Stat(authFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("authfile must be readable only by the user, got %v", info.Mode().Perm())
+	}
+
+	encoded, _ := os.ReadFile(authFile)
+
+	var config dockerConfigJSON
+	if err := json.Unmarshal(encoded, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if username, password, _ := config.Auths["harbor.local"].Credentials(); username != "robot" || password != "secret" {
+		t.Errorf("unexpected credentials %s:%s", username, password)
+	}
+}
@@ -14,8 +14,45 @@
 
 package image
 
+import "time"
+
 // Image is an actionable object of a container image.
 type Image struct {
-	// Filepath points to the location where the image is stored.
-	ImageName string
+	// Reference is the fully-qualified reference that the image was requested with.
+	Reference string `json:"reference"`
+
+	// ImageName is the reference that the runtime runs the image with.
+	ImageName string `json:"imageName"`
+
+	// Digest identifies the content of the image (e.g, sha256:...).
+	Digest string `json:"digest,omitempty"`
+
+	// PulledAt is the time the image was pulled into the cache.
+	PulledAt time.Time `json:"pulledAt"`
+
+	// LastUsedAt is the last time a pod has requested the image. It is used by the garbage collector.
+	LastUsedAt time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// LastUsed returns the last time the image was used. Records of older versions fall back to the pull time.
+func (img *Image) LastUsed() time.Time {
+	if img.LastUsedAt.After(img.PulledAt) {
+		return img.LastUsedAt
+	}
+
+	return img.PulledAt
+}
+
+// ID returns the image ID for the container status (e.g, docker.io/library/nginx@sha256:...).
+func (img *Image) ID() string {
+	if img.Digest == "" {
+		return img.ImageName
+	}
+
+	ref, err := ParseReference(img.ImageName)
+	if err != nil {
+		return img.ImageName
+	}
+
+	return ref.Name() + "@" + img.Digest
 }
@@ -0,0 +1,394 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/metrics"
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+/*
+The garbage collector removes the images that HPK has pulled (i.e, the images in the index), and no pod uses.
+Images that are stored by the runtime, but are not in the index, belong to the user and they are never removed.
+As in the kubelet, there are two policies:
+  - Usage: if the usage of the filesystem that holds the image store of the runtime exceeds the high threshold,
+    the least recently used images are removed until the usage drops below the low threshold. On a shared
+    filesystem (e.g, the scratch of the cluster), the usage includes the files of other users, which HPK cannot
+    reclaim. Therefore, this policy is disabled by default.
+  - Age: images that have not been used for longer than the maximum age are removed, regardless of the usage.
+*/
+
+// ImageGCPeriod is the interval between two runs of the garbage collector, as in the kubelet.
+var ImageGCPeriod = 5 * time.Minute
+
+// GCPolicy configures the garbage collection of images.
+type GCPolicy struct {
+	// HighThresholdPercent is the disk usage that triggers the garbage collection. 100 disables it.
+	HighThresholdPercent int
+
+	// LowThresholdPercent is the disk usage that the garbage collection tries to reach.
+	LowThresholdPercent int
+
+	// MinAge is the minimum time that an image must be unused before it is removed.
+	MinAge time.Duration
+
+	// MaxAge is the maximum time that an image can be unused before it is removed. Zero disables it.
+	MaxAge time.Duration
+}
+
+// Validate checks the thresholds of the policy.
+func (p GCPolicy) Validate() error {
+	if p.HighThresholdPercent < 0 || p.HighThresholdPercent > 100 {
+		return errors.Errorf("image-gc-high-threshold must be in [0, 100], got '%d'", p.HighThresholdPercent)
+	}
+
+	if p.LowThresholdPercent < 0 || p.LowThresholdPercent > 100 {
+		return errors.Errorf("image-gc-low-threshold must be in [0, 100], got '%d'", p.LowThresholdPercent)
+	}
+
+	if p.LowThresholdPercent > p.HighThresholdPercent {
+		return errors.Errorf("image-gc-low-threshold (%d) must not exceed image-gc-high-threshold (%d)",
+			p.LowThresholdPercent, p.HighThresholdPercent)
+	}
+
+	if p.MaxAge != 0 && p.MaxAge < p.MinAge {
+		return errors.Errorf("image-maximum-gc-age (%s) must not be less than image-minimum-gc-age (%s)",
+			p.MaxAge, p.MinAge)
+	}
+
+	return nil
+}
+
+// ImagesInUse returns the names of the images that are used by the pods, as they appear in their specs.
+type ImagesInUse func() ([]string, error)
+
+// RunGarbageCollector runs the garbage collection periodically, until the context is cancelled.
+func RunGarbageCollector(ctx context.Context, imageDir string, policy GCPolicy, inUse ImagesInUse) {
+	logger := compute.DefaultLogger.WithName("image-gc")
+
+	ticker := time.NewTicker(ImageGCPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reclaimed, err := GarbageCollect(imageDir, policy, inUse)
+		if err != nil {
+			logger.Error(err, "Image garbage collection has failed")
+
+			continue
+		}
+
+		if reclaimed > 0 {
+			logger.Info("Image garbage collection is completed", "reclaimedBytes", reclaimed)
+		}
+	}
+}
+
+// gcCandidate is an image of the index that no pod uses.
+type gcCandidate struct {
+	ref  Reference
+	img  *Image
+	size int64
+}
+
+// GarbageCollect makes a single run of the garbage collection, and returns the bytes that it has reclaimed.
+func GarbageCollect(imageDir string, policy GCPolicy, inUse ImagesInUse) (int64, error) {
+	logger := compute.DefaultLogger.WithName("image-gc")
+
+	/*---------------------------------------------------
+	 * Find the Images that are Unused
+	 *---------------------------------------------------*/
+	// fail if the pods are unknown, otherwise all the images would seem unused.
+	used, err := inUse()
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to find the images in use")
+	}
+
+	records, err := listRecords(imageDir)
+	if err != nil {
+		return 0, err
+	}
+
+	candidates := unusedImages(records, used, time.Now().Add(-policy.MinAge))
+
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+
+	/*---------------------------------------------------
+	 * Select the Images to Remove
+	 *---------------------------------------------------*/
+	var bytesToFree int64
+
+	if policy.HighThresholdPercent < 100 {
+		store, err := imageStore()
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to find the image store")
+		}
+
+		capacity, available, err := diskUsage(store)
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to get the usage of '%s'", store)
+		}
+
+		usage := capacity - available
+
+		if capacity > 0 && usage*100/capacity >= int64(policy.HighThresholdPercent) {
+			bytesToFree = usage - capacity*int64(policy.LowThresholdPercent)/100
+
+			logger.Info("Disk usage is above the high threshold",
+				"usagePercent", usage*100/capacity,
+				"highThresholdPercent", policy.HighThresholdPercent,
+				"bytesToFree", bytesToFree,
+			)
+		}
+	}
+
+	if bytesToFree <= 0 && policy.MaxAge == 0 {
+		return 0, nil
+	}
+
+	stored, err := listStoredImages()
+	if err != nil {
+		return 0, err
+	}
+
+	var present []gcCandidate
+
+	for _, candidate := range candidates {
+		// images that have been removed from the runtime leave stale records.
+		if !isStored(stored, candidate.ref) {
+			if err := RemoveRecord(imageDir, candidate.ref); err != nil {
+				return 0, errors.Wrapf(err, "failed to remove stale record of image '%s'", candidate.ref)
+			}
+
+			continue
+		}
+
+		// the size is only an estimation, since images may share layers.
+		if size, err := imageSize(candidate.img.ImageName); err == nil {
+			candidate.size = size
+		}
+
+		present = append(present, candidate)
+	}
+
+	/*---------------------------------------------------
+	 * Remove the Selected Images
+	 *---------------------------------------------------*/
+	var reclaimed int64
+
+	for _, candidate := range selectImagesToRemove(present, bytesToFree, policy.MaxAge, time.Now()) {
+		if err := removeImage(candidate.img.ImageName); err != nil {
+			logger.Error(err, "Failed to remove image", "image", candidate.ref.String())
+
+			continue
+		}
+
+		if err := RemoveRecord(imageDir, candidate.ref); err != nil {
+			return reclaimed, errors.Wrapf(err, "failed to remove record of image '%s'", candidate.ref)
+		}
+
+		logger.Info("Image has been removed",
+			"image", candidate.ref.String(),
+			"lastUsed", candidate.img.LastUsed(),
+			"sizeBytes", candidate.size,
+		)
+
+		reclaimed += candidate.size
+
+		metrics.ImagesRemoved.Inc()
+		metrics.ImageGCReclaimedBytes.Add(float64(candidate.size))
+	}
+
+	return reclaimed, nil
+}
+
+/*
+unusedImages returns the images of the index that are not used by any pod, and have not been used after the
+deadline. Images are used by reference, or by digest (e.g, nginx:1.25 uses the record of nginx@sha256:...).
+*/
+func unusedImages(records map[Reference]*Image, used []string, deadline time.Time) []gcCandidate {
+	usedRefs := make(map[string]bool)
+	usedDigests := make(map[string]bool)
+
+	for _, name := range used {
+		ref, err := ParseReference(name)
+		if err != nil {
+			continue
+		}
+
+		// the records are kept by the images that are actually pulled.
+		ref, _ = Rewrites.Rewrite(ref)
+
+		usedRefs[ref.String()] = true
+
+		if ref.Digest != "" {
+			usedDigests[ref.Digest] = true
+		}
+
+		if img, exists := records[ref]; exists && img.Digest != "" {
+			usedDigests[img.Digest] = true
+		}
+	}
+
+	var candidates []gcCandidate
+
+	for ref, img := range records {
+		if usedRefs[ref.String()] || (img.Digest != "" && usedDigests[img.Digest]) {
+			continue
+		}
+
+		if img.LastUsed().After(deadline) {
+			continue
+		}
+
+		candidates = append(candidates, gcCandidate{ref: ref, img: img})
+	}
+
+	return candidates
+}
+
+/*
+selectImagesToRemove returns the images that have exceeded the maximum age, and the least recently used images
+until the bytes to free are reclaimed.
+*/
+func selectImagesToRemove(candidates []gcCandidate, bytesToFree int64, maxAge time.Duration, now time.Time) []gcCandidate {
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].img.LastUsed().Before(candidates[j].img.LastUsed())
+	})
+
+	var (
+		selected []gcCandidate
+		freed    int64
+	)
+
+	for _, candidate := range candidates {
+		expired := maxAge > 0 && now.Sub(candidate.img.LastUsed()) > maxAge
+
+		if !expired && freed >= bytesToFree {
+			continue
+		}
+
+		selected = append(selected, candidate)
+		freed += candidate.size
+	}
+
+	return selected
+}
+
+/*---------------------------------------------------
+ * Helpers
+ *---------------------------------------------------*/
+
+// listRecords returns the images of the index, by their reference. Corrupted records are ignored.
+func listRecords(imageDir string) (map[Reference]*Image, error) {
+	entries, err := os.ReadDir(imageDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read image directory '%s'", imageDir)
+	}
+
+	records := make(map[Reference]*Image)
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), recordExtension) {
+			continue
+		}
+
+		encoded, err := os.ReadFile(filepath.Join(imageDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		var img Image
+		if err := json.Unmarshal(encoded, &img); err != nil {
+			continue
+		}
+
+		ref, err := ParseReference(img.Reference)
+		if err != nil {
+			continue
+		}
+
+		records[ref] = &img
+	}
+
+	return records, nil
+}
+
+func isStored(stored []storedImage, ref Reference) bool {
+	for _, img := range stored {
+		if img.matches(ref) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// imageStore returns the directory wherein the runtime stores the layers of the images.
+var imageStore = func() (string, error) {
+	out, err := process.Execute(compute.Environment.PodmanBin, "info", "--format={{.Store.GraphRoot}}")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// diskUsage returns the capacity and the available bytes of the filesystem that holds the path.
+var diskUsage = func(path string) (capacity int64, available int64, err error) {
+	var statfs unix.Statfs_t
+
+	if err := unix.Statfs(path, &statfs); err != nil {
+		return 0, 0, err
+	}
+
+	return int64(statfs.Blocks) * statfs.Bsize, int64(statfs.Bavail) * statfs.Bsize, nil
+}
+
+// imageSize returns the size of the image in the store of the runtime.
+var imageSize = func(imageName string) (int64, error) {
+	out, err := process.Execute(compute.Environment.PodmanBin, "image", "inspect", "--format={{.Size}}", imageName)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+}
+
+// removeImage removes the image from the store of the runtime.
+var removeImage = func(imageName string) error {
+	_, err := process.Execute(compute.Environment.PodmanBin, "rmi", imageName)
+
+	return err
+}
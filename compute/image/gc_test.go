@@ -0,0 +1,157 @@
+package image
+
+import (
+	"testing"
+	"time"
+)
+
+const testDigest = "sha256:4b9f2e2c3c7fa1a3e0b2a8b0d2b7c1f3e6a5d4c3b2a190817263544536271809"
+
+func testRecords(t *testing.T, now time.Time, images map[string]time.Duration) map[Reference]*Image {
+	records := make(map[Reference]*Image)
+
+	for name, unused := range images {
+		ref, err := ParseReference(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		img := &Image{Reference: ref.String(), ImageName: ref.Pullable(), PulledAt: now.Add(-unused)}
+		if name == "nginx:1.25" {
+			img.Digest = testDigest
+		}
+
+		records[ref] = img
+	}
+
+	return records
+}
+
+func Test_unusedImages(t *testing.T) {
+	now := time.Now()
+
+	records := testRecords(t, now, map[string]time.Duration{
+		"nginx:1.25":   time.Hour,
+		"redis:7":      time.Hour,
+		"busybox":      time.Hour,
+		"alpine:3.18":  time.Second,
+		"quay.io/a/b":  time.Hour,
+		"postgres:16":  time.Hour,
+		"localhost/cd": time.Hour,
+	})
+
+	used := []string{
+		"docker.io/library/redis:7",
+		"nginx@" + testDigest,
+		"quay.io/a/b:latest",
+		"not a valid name",
+	}
+
+	candidates := unusedImages(records, used, now.Add(-2*time.Minute))
+
+	got := make(map[string]bool)
+	for _, c := range candidates {
+		got[c.ref.String()] = true
+	}
+
+	want := map[string]bool{
+		"docker.io/library/busybox:latest": true,
+		"docker.io/library/postgres:16":    true,
+		"localhost/cd:latest":              true,
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("unusedImages() = %v, want %v", got, want)
+	}
+
+	for name := range want {
+		if !got[name] {
+			t.Errorf("expected '%s' to be unused", name)
+		}
+	}
+}
+
+func Test_selectImagesToRemove(t *testing.T) {
+	now := time.Now()
+
+	candidate := func(name string, unused time.Duration, size int64) gcCandidate {
+		ref, err := ParseReference(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return gcCandidate{ref: ref, img: &Image{PulledAt: now.Add(-unused)}, size: size}
+	}
+
+	tests := []struct {
+		name        string
+		bytesToFree int64
+		maxAge      time.Duration
+		want        []string
+	}{
+		{name: "no pressure", want: nil},
+		{
+			name:        "least recently used first",
+			bytesToFree: 150,
+			want:        []string{"docker.io/library/old:latest", "docker.io/library/older:latest"},
+		},
+		{
+			name:   "max age",
+			maxAge: 36 * time.Hour,
+			want:   []string{"docker.io/library/old:latest"},
+		},
+		{
+			name:        "max age and pressure",
+			bytesToFree: 10,
+			maxAge:      36 * time.Hour,
+			want:        []string{"docker.io/library/old:latest"},
+		},
+		{
+			name:        "free everything",
+			bytesToFree: 1000,
+			want:        []string{"docker.io/library/old:latest", "docker.io/library/older:latest", "docker.io/library/recent:latest"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates := []gcCandidate{
+				candidate("recent", time.Hour, 100),
+				candidate("old", 48*time.Hour, 100),
+				candidate("older", 24*time.Hour, 100),
+			}
+
+			selected := selectImagesToRemove(candidates, tt.bytesToFree, tt.maxAge, now)
+
+			if len(selected) != len(tt.want) {
+				t.Fatalf("selected %d images, want %v", len(selected), tt.want)
+			}
+
+			for i := range selected {
+				if selected[i].ref.String() != tt.want[i] {
+					t.Errorf("selected[%d] = %s, want %s", i, selected[i].ref, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGCPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		policy  GCPolicy
+		wantErr bool
+	}{
+		{policy: GCPolicy{HighThresholdPercent: 85, LowThresholdPercent: 80, MinAge: 2 * time.Minute}},
+		{policy: GCPolicy{HighThresholdPercent: 100, LowThresholdPercent: 100}},
+		{policy: GCPolicy{HighThresholdPercent: 101, LowThresholdPercent: 80}, wantErr: true},
+		{policy: GCPolicy{HighThresholdPercent: 80, LowThresholdPercent: 85}, wantErr: true},
+		{policy: GCPolicy{HighThresholdPercent: 85, LowThresholdPercent: -1}, wantErr: true},
+		{policy: GCPolicy{HighThresholdPercent: 85, LowThresholdPercent: 80, MinAge: time.Hour, MaxAge: time.Minute}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.policy, err, tt.wantErr)
+		}
+	}
+}
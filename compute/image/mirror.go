@@ -0,0 +1,184 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+Rewrite rules redirect the images to registries that the compute nodes can reach (e.g, an internal mirror).
+A rule is written as "FROM=TO", where FROM and TO are repositories. A trailing "/*" matches every repository
+under the prefix, and it is replaced by the remainder of the repository. For example, with the rule
+"docker.io/*=harbor.local/dockerhub/*", nginx:1.25 is pulled as harbor.local/dockerhub/library/nginx:1.25.
+Tags and digests are kept.
+*/
+
+const wildcard = "/*"
+
+// Rewrites are the rules that are applied to every image before it is pulled.
+var Rewrites RewriteRules
+
+// RewriteRule redirects the repositories that match From to To.
+type RewriteRule struct {
+	From string
+	To   string
+
+	// prefix is set if the rule matches every repository under From.
+	prefix bool
+}
+
+// RewriteRules are evaluated in order, and the first rule that matches an image is applied.
+type RewriteRules []RewriteRule
+
+// ParseRewriteRule parses a rule written as "FROM=TO" (e.g, "docker.io/*=harbor.local/dockerhub/*").
+func ParseRewriteRule(rule string) (RewriteRule, error) {
+	from, to, found := strings.Cut(rule, "=")
+	if !found {
+		return RewriteRule{}, errors.Errorf("invalid rule '%s': expected 'FROM=TO'", rule)
+	}
+
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+
+	if strings.HasSuffix(from, wildcard) != strings.HasSuffix(to, wildcard) {
+		return RewriteRule{}, errors.Errorf("invalid rule '%s': either both or none of FROM and TO must end with '%s'",
+			rule, wildcard)
+	}
+
+	r := RewriteRule{
+		From:   strings.TrimSuffix(from, wildcard),
+		To:     strings.TrimSuffix(to, wildcard),
+		prefix: strings.HasSuffix(from, wildcard),
+	}
+
+	if r.From == "" || r.To == "" || strings.Contains(r.From+r.To, "*") {
+		return RewriteRule{}, errors.Errorf("invalid rule '%s': wildcards are allowed only at the end", rule)
+	}
+
+	// exact repositories are normalized, so that "nginx" matches docker.io/library/nginx.
+	if !r.prefix {
+		ref, err := ParseReference(r.From)
+		if err != nil {
+			return RewriteRule{}, errors.Wrapf(err, "invalid rule '%s'", rule)
+		}
+
+		r.From = ref.Name()
+	}
+
+	// the target must name its registry explicitly, otherwise it would be resolved to the default one.
+	sample := r.To
+	if r.prefix {
+		sample += "/image"
+	}
+
+	ref, err := ParseReference(sample)
+	if err != nil {
+		return RewriteRule{}, errors.Wrapf(err, "invalid rule '%s'", rule)
+	}
+
+	if ref.Name() != sample {
+		return RewriteRule{}, errors.Errorf("invalid rule '%s': '%s' must start with a registry", rule, r.To)
+	}
+
+	return r, nil
+}
+
+/*
+NewRewriteRules parses the rules. If mirror is set, it is the mirror of the default registry (see --registry),
+and it is applied after the rules.
+*/
+func NewRewriteRules(rules []string, mirror string) (RewriteRules, error) {
+	var parsed RewriteRules
+
+	for _, rule := range rules {
+		r, err := ParseRewriteRule(rule)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed = append(parsed, r)
+	}
+
+	// the registry was formerly given as a transport (e.g, docker://).
+	if _, withoutTransport, found := strings.Cut(mirror, "://"); found {
+		mirror = withoutTransport
+	}
+
+	if mirror = strings.TrimSuffix(mirror, "/"); mirror != "" {
+		r, err := ParseRewriteRule(DefaultDomain + wildcard + "=" + mirror + wildcard)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid registry '%s'", mirror)
+		}
+
+		parsed = append(parsed, r)
+	}
+
+	return parsed, nil
+}
+
+// Rewrite applies the first rule that matches the reference. It returns false if no rule matches.
+func (rules RewriteRules) Rewrite(ref Reference) (Reference, bool) {
+	name := ref.Name()
+
+	for _, r := range rules {
+		var rewritten string
+
+		switch {
+		case r.prefix && strings.HasPrefix(name, r.From+"/"):
+			rewritten = r.To + strings.TrimPrefix(name, r.From)
+		case !r.prefix && name == r.From:
+			rewritten = r.To
+		default:
+			continue
+		}
+
+		newRef, err := ParseReference(rewritten)
+		if err != nil {
+			// the rules are validated, so this is a repository that the registry does not accept anyway.
+			return ref, false
+		}
+
+		newRef.Tag, newRef.Digest = ref.Tag, ref.Digest
+
+		return newRef, true
+	}
+
+	return ref, false
+}
+
+// RewriteName applies the rules to the name of an image. Names that cannot be parsed, or match no rule, are kept.
+func (rules RewriteRules) RewriteName(imageName string) (string, bool) {
+	ref, err := ParseReference(imageName)
+	if err != nil {
+		return imageName, false
+	}
+
+	rewritten, ok := rules.Rewrite(ref)
+	if !ok {
+		return imageName, false
+	}
+
+	return rewritten.String(), true
+}
+
+func (r RewriteRule) String() string {
+	if r.prefix {
+		return r.From + wildcard + "=" + r.To + wildcard
+	}
+
+	return r.From + "=" + r.To
+}
@@ -0,0 +1,86 @@
+package image
+
+import (
+	"testing"
+)
+
+func TestParseRewriteRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    string
+		wantErr bool
+	}{
+		{rule: "docker.io/*=harbor.local/dockerhub/*", want: "docker.io/*=harbor.local/dockerhub/*"},
+		{rule: " quay.io/* = harbor.local/quay/* ", want: "quay.io/*=harbor.local/quay/*"},
+		{rule: "nginx=harbor.local/web/nginx", want: "docker.io/library/nginx=harbor.local/web/nginx"},
+		{rule: "docker.io/*=localhost:5000/*", want: "docker.io/*=localhost:5000/*"},
+		{rule: "docker.io/*", wantErr: true},
+		{rule: "docker.io/*=harbor.local/dockerhub", wantErr: true},
+		{rule: "docker.io=harbor.local/*", wantErr: true},
+		{rule: "docker.io/*/nginx=harbor.local/nginx", wantErr: true},
+		{rule: "docker.io/*=mirror/*", wantErr: true},
+		{rule: "=harbor.local/nginx", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRewriteRule(tt.rule)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRewriteRule(%s) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+
+			continue
+		}
+
+		if !tt.wantErr && got.String() != tt.want {
+			t.Errorf("ParseRewriteRule(%s) = %s, want %s", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteRules_Rewrite(t *testing.T) {
+	rules, err := NewRewriteRules([]string{
+		"docker.io/library/nginx=harbor.local/web/nginx",
+		"quay.io/jetstack/*=harbor.local/jetstack/*",
+	}, "docker://harbor.local/dockerhub/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		image     string
+		want      string
+		rewritten bool
+	}{
+		{image: "nginx:1.25", want: "harbor.local/web/nginx:1.25", rewritten: true},
+		{image: "busybox", want: "harbor.local/dockerhub/library/busybox:latest", rewritten: true},
+		{image: "bitnami/redis:7", want: "harbor.local/dockerhub/bitnami/redis:7", rewritten: true},
+		{
+			image:     "quay.io/jetstack/cert-manager-cainjector:v1.12.3@sha256:4b9f2e2c3c7fa1a3e0b2a8b0d2b7c1f3e6a5d4c3b2a190817263544536271809",
+			want:      "harbor.local/jetstack/cert-manager-cainjector:v1.12.3@sha256:4b9f2e2c3c7fa1a3e0b2a8b0d2b7c1f3e6a5d4c3b2a190817263544536271809",
+			rewritten: true,
+		},
+		{image: "quay.io/jetstackx/agent:v1", want: "quay.io/jetstackx/agent:v1"},
+		{image: "registry.k8s.io/pause:3.9", want: "registry.k8s.io/pause:3.9"},
+		{image: "harbor.local/dockerhub/library/nginx:1.25", want: "harbor.local/dockerhub/library/nginx:1.25"},
+		{image: "Invalid Name", want: "Invalid Name"},
+	}
+
+	for _, tt := range tests {
+		got, rewritten := rules.RewriteName(tt.image)
+		if got != tt.want || rewritten != tt.rewritten {
+			t.Errorf("RewriteName(%s) = %s, %v, want %s, %v", tt.image, got, rewritten, tt.want, tt.rewritten)
+		}
+	}
+}
+
+func TestNewRewriteRules_NoMirror(t *testing.T) {
+	for _, mirror := range []string{"", "docker://"} {
+		rules, err := NewRewriteRules(nil, mirror)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rules) != 0 {
+			t.Errorf("NewRewriteRules(nil, %s) = %v, want no rules", mirror, rules)
+		}
+	}
+}
@@ -15,77 +15,229 @@
 package image
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
 	"strings"
-	"fmt"
+	"time"
+
 	"github.com/carv-ics-forth/hpk/compute"
 	"github.com/carv-ics-forth/hpk/pkg/process"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	// ErrImageNeverPull is returned for images that are not cached, and the pull policy forbids pulling them.
+	ErrImageNeverPull = errors.New("image is not present with pull policy of Never")
+
+	// ErrInvalidImageName is returned for images whose reference cannot be parsed. Retrying the pull is futile.
+	ErrInvalidImageName = errors.New("invalid image name")
 )
 
-func Pull(imageDir string, transport Transport, imageName string) (*Image, error) {
-	// Remove the digest from the image, because Singularity fails with
-	// "Docker references with both a tag and digest are currently not supported".
-	imageName = strings.Split(imageName, "@")[0]
+// DefaultPullPolicy is the policy for containers without one, as the API server defaults it.
+func DefaultPullPolicy(ref Reference) corev1.PullPolicy {
+	if ref.Digest == "" && ref.Tag == DefaultTag {
+		return corev1.PullAlways
+	}
+
+	return corev1.PullIfNotPresent
+}
 
-	/*
-	
-	Keep in mind the ImagePullpolicy implementation for the future 
+// PullOptions configure the pull of an image.
+type PullOptions struct {
+	// Policy is the ImagePullPolicy of the container. If empty, it is defaulted as by the API server.
+	Policy corev1.PullPolicy
 
-	*/
+	// Keyring holds the credentials of the pod for private registries (see imagePullSecrets).
+	Keyring Keyring
+}
 
-	res, err := process.Execute(compute.Environment.PodmanBin, "images", fmt.Sprintf("--format=\"{{.Names}}|{{.IsReadOnly}}\""))
+/*
+Pull returns the image from the cache, or downloads it, according to the pull policy:
+  - Always: the image is downloaded, and the runtime reuses the layers that are already stored.
+  - IfNotPresent: the image is downloaded only if it is not cached.
+  - Never: the image must be cached, otherwise ErrImageNeverPull is returned.
+
+Concurrent pulls of the same reference, with the same credentials, are performed once. If the context is
+cancelled (e.g, the pod is deleted), Pull returns, and the download is killed unless other pods wait for it.
+The credentials are given only to the pull, and they are never stored.
+The rewrite rules (see Rewrites) are applied before the cache is looked up.
+*/
+func Pull(ctx context.Context, imageDir string, transport Transport, imageName string, opts PullOptions) (*Image, error) {
+	ref, err := ParseReference(imageName)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to check the image")
+		return nil, errors.Wrapf(ErrInvalidImageName, "%s", err)
 	}
 
+	policy := opts.Policy
 
-	cleanOutput := strings.Trim(string(res), "{}\" \n")
+	// the policy is defaulted by the requested tag, as by the API server.
+	if policy == "" {
+		policy = DefaultPullPolicy(ref)
+	}
 
-	// TODO: 
-	// Add the tag if there is no tag appending the latest tag
+	logger := compute.DefaultLogger.WithValues("policy", policy)
 
-	// Split the output into lines
-	lines := strings.Split(cleanOutput, "\n")
+	// the image is cached, and authenticated, as the image that is actually pulled.
+	if rewritten, ok := Rewrites.Rewrite(ref); ok {
+		logger = logger.WithValues("requested", ref.String())
+		ref = rewritten
+	}
 
-	// Check every line to see if the image already exists
-	for _, line := range lines {
-		
-		// Trim extra quotes and spaces
-		line = strings.Trim(line, "\" ")
+	logger = logger.WithValues("image", ref.String())
 
-		// Split by the '|' character
-		parts := strings.Split(line, "|")
-		if len(parts) != 2 {
-			continue
+	/*---------------------------------------------------
+	 * Look up the Cache
+	 *---------------------------------------------------*/
+	if policy != corev1.PullAlways {
+		img, err := lookup(imageDir, ref)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to look up image '%s'", ref)
 		}
 
-		// Extract image name and condition
-		imagePart := strings.Trim(parts[0], "[] ")
-		// remove the tag at the end of the image name
-		imagePart = strings.Split(imagePart, ":")[0]
-		condition := strings.Trim(parts[1], " ")
-
-		// Check if the image name matches and condition is true
-		if imagePart == imageName && condition == "true" {
-			compute.DefaultLogger.Info(" * Image already exists", "image", imageName, "path", imageName)
-			return &Image{
-				ImageName: imageName,
-			}, nil
+		if img != nil {
+			logger.Info(" * Image already exists", "digest", img.Digest)
+
+			return img, nil
+		}
+
+		if policy == corev1.PullNever {
+			return nil, errors.Wrapf(ErrImageNeverPull, "image '%s'", ref)
 		}
 	}
-	compute.DefaultLogger.Info(" * Image does not exist", "image", imageName, "path", imageName)
 
+	/*---------------------------------------------------
+	 * Download the Image
+	 *---------------------------------------------------*/
+	auth, authenticated := opts.Keyring.Lookup(ref)
+
+	var username, password string
+
+	if authenticated {
+		username, password, err = auth.Credentials()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid credentials for image '%s'", ref)
+		}
+	}
+
+	return singlePull(ctx, pullKey(ref, authenticated, username, password), func(ctx context.Context) (*Image, error) {
+		logger.Info(" * Downloading image", "authenticated", authenticated)
+
+		pullArgs := []string{"pull"}
+
+		// podman reads the credentials only from the authfile, so they are never exposed to child processes.
+		if authenticated {
+			authFile, err := writeAuthFile(ref, username, password)
+			if err != nil {
+				return nil, err
+			}
+
+			defer os.Remove(authFile)
+
+			pullArgs = append(pullArgs, "--authfile", authFile)
+		}
+
+		pullArgs = append(pullArgs, ref.Pullable())
+
+		if _, err := process.ExecuteContext(ctx, compute.Environment.PodmanBin, pullArgs...); err != nil {
+			return nil, errors.Wrapf(err, "downloading has failed")
+		}
+
+		img := &Image{
+			Reference: ref.String(),
+			ImageName: ref.Pullable(),
+			Digest:    ref.Digest,
+			PulledAt:  time.Now(),
+		}
 
-	// otherwise, download a fresh copy
-	if _, err := process.Execute(compute.Environment.PodmanBin, "pull", imageName); err != nil {
-		return nil, errors.Wrapf(err, "downloading has failed")
+		if img.Digest == "" {
+			out, err := process.ExecuteContext(ctx, compute.Environment.PodmanBin, "image", "inspect", "--format={{.Digest}}", img.ImageName)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to inspect image '%s'", img.ImageName)
+			}
+
+			img.Digest = strings.TrimSpace(string(out))
+		}
+
+		if err := SaveRecord(imageDir, ref, img); err != nil {
+			return nil, errors.Wrapf(err, "failed to cache image '%s'", ref)
+		}
+
+		logger.Info(" * Download completed", "digest", img.Digest)
+
+		return img, nil
+	})
+}
+
+/*
+pullKey identifies the pulls that can be shared, i.e, the pulls of the same reference with the same credentials
+for the registry. The credentials are hashed, so that they are not kept in the keys.
+*/
+func pullKey(ref Reference, authenticated bool, username string, password string) string {
+	if !authenticated {
+		return ref.String()
+	}
+
+	sum := sha256.Sum256([]byte(ref.Domain + "\x00" + username + "\x00" + password))
+
+	return ref.String() + "|" + hex.EncodeToString(sum[:])
+}
+
+/*
+lookup returns the cached image for the reference, or nil if it is not cached. The index is checked against
+the store of the runtime, because images may have been removed from there. Conversely, images that are
+stored but missing from the index (e.g, pulled by older versions) are added to it.
+*/
+func lookup(imageDir string, ref Reference) (*Image, error) {
+	stored, err := listStoredImages()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *storedImage
+
+	for i := range stored {
+		if stored[i].ReadOnly && stored[i].matches(ref) {
+			found = &stored[i]
+
+			break
+		}
+	}
+
+	img, err := LoadRecord(imageDir, ref)
+
+	switch {
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+
+	case found == nil:
+		// stale record.
+		if img != nil {
+			if err := RemoveRecord(imageDir, ref); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+
+	case img == nil:
+		img = &Image{
+			Reference: ref.String(),
+			ImageName: ref.Pullable(),
+			Digest:    found.Digest,
+			PulledAt:  time.Now(),
+		}
 	}
 
+	// keep the image from the garbage collector.
+	img.LastUsedAt = time.Now()
 
-	img := &Image{
-		ImageName: imageName,	
+	if err := SaveRecord(imageDir, ref, img); err != nil {
+		return nil, err
 	}
-	compute.DefaultLogger.Info(" * Download completed", "image", imageName, "path", img.ImageName)
 
 	return img, nil
 }
@@ -1,10 +1,13 @@
 package image_test
 
 import (
+	"context"
+	"os/exec"
 	"testing"
 
 	"github.com/carv-ics-forth/hpk/compute"
 	"github.com/carv-ics-forth/hpk/compute/image"
+	corev1 "k8s.io/api/core/v1"
 )
 
 func Test_ParseImageName(t *testing.T) {
@@ -34,6 +37,9 @@ func Test_ParseImageName(t *testing.T) {
 }
 
 func TestPull(t *testing.T) {
+	if _, err := exec.LookPath(compute.Environment.PodmanBin); err != nil {
+		t.Skipf("the container runtime is not available: %v", err)
+	}
 
 	imageDir := compute.HPK.ImageDir()
 
@@ -51,7 +57,7 @@ func TestPull(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := image.Pull(imageDir, image.Docker, tt.imageName)
+			_, err := image.Pull(context.Background(), imageDir, image.Docker, tt.imageName, image.PullOptions{Policy: corev1.PullIfNotPresent})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Pull() error = %v, wantErr %v", err, tt.wantErr)
 				return
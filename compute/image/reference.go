@@ -0,0 +1,152 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultDomain is the registry of images without a registry (e.g, busybox).
+	DefaultDomain = "docker.io"
+
+	// DefaultTag is the tag of images without a tag or digest.
+	DefaultTag = "latest"
+
+	// officialRepository is the namespace of the official images in the default registry.
+	officialRepository = "library/"
+)
+
+var (
+	pathPattern   = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagPattern    = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestPattern = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+)
+
+/*
+Reference is the fully-qualified name of an image, as the kubelet normalizes it.
+For example, "nginx:1.25" becomes "docker.io/library/nginx:1.25".
+*/
+type Reference struct {
+	// Domain is the registry of the image (e.g, docker.io, quay.io, localhost:5000).
+	Domain string
+
+	// Path is the repository within the registry (e.g, library/nginx).
+	Path string
+
+	// Tag is empty if the image is referenced only by digest.
+	Tag string
+
+	// Digest identifies the content of the image (e.g, sha256:...). It is empty if the image is referenced by tag.
+	Digest string
+}
+
+// ParseReference normalizes the name of an image. The transport (e.g, docker://) is ignored.
+func ParseReference(rawImageName string) (Reference, error) {
+	var ref Reference
+
+	name := rawImageName
+	if _, withoutTransport, found := strings.Cut(name, "://"); found {
+		name = withoutTransport
+	}
+
+	if name == "" {
+		return Reference{}, errors.Errorf("empty image name")
+	}
+
+	/*-- Split the digest --*/
+	if withoutDigest, digest, found := strings.Cut(name, "@"); found {
+		if !digestPattern.MatchString(digest) {
+			return Reference{}, errors.Errorf("invalid digest '%s' in image '%s'", digest, rawImageName)
+		}
+
+		name, ref.Digest = withoutDigest, digest
+	}
+
+	/*-- Split the tag, which is after the last slash, because the domain may have a port --*/
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+
+		if !tagPattern.MatchString(ref.Tag) {
+			return Reference{}, errors.Errorf("invalid tag '%s' in image '%s'", ref.Tag, rawImageName)
+		}
+	}
+
+	/*-- Split the domain. The first component is a domain only if it looks like a host --*/
+	if domain, path, found := strings.Cut(name, "/"); found &&
+		(strings.ContainsAny(domain, ".:") || domain == "localhost" || domain != strings.ToLower(domain)) {
+		ref.Domain, ref.Path = domain, path
+	} else {
+		ref.Domain, ref.Path = DefaultDomain, name
+	}
+
+	if ref.Domain == "index.docker.io" {
+		ref.Domain = DefaultDomain
+	}
+
+	if ref.Domain == DefaultDomain && !strings.Contains(ref.Path, "/") {
+		ref.Path = officialRepository + ref.Path
+	}
+
+	if !pathPattern.MatchString(ref.Path) {
+		return Reference{}, errors.Errorf("invalid repository '%s' in image '%s'", ref.Path, rawImageName)
+	}
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = DefaultTag
+	}
+
+	return ref, nil
+}
+
+// Name is the repository of the image, without tag and digest (e.g, docker.io/library/nginx).
+func (r Reference) Name() string {
+	return r.Domain + "/" + r.Path
+}
+
+// String returns the fully-qualified reference, with both the tag and digest, if they are set.
+func (r Reference) String() string {
+	s := r.Name()
+
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+
+	return s
+}
+
+/*
+Pullable returns the reference that the runtime pulls. The digest takes precedence over the tag,
+because runtimes do not support references with both.
+*/
+func (r Reference) Pullable() string {
+	if r.Digest != "" {
+		return r.Name() + "@" + r.Digest
+	}
+
+	return r.Name() + ":" + r.Tag
+}
+
+// Key is a filename for the reference.
+func (r Reference) Key() string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(r.String())
+}
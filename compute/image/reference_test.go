@@ -0,0 +1,72 @@
+package image_test
+
+import (
+	"testing"
+
+	"github.com/carv-ics-forth/hpk/compute/image"
+)
+
+func Test_ParseReference(t *testing.T) {
+	tests := []struct {
+		name     string
+		image    string
+		want     string
+		pullable string
+		wantErr  bool
+	}{
+		{
+			name:     "official",
+			image:    "nginx",
+			want:     "docker.io/library/nginx:latest",
+			pullable: "docker.io/library/nginx:latest",
+		},
+		{
+			name:     "transport",
+			image:    "docker://busybox:1.36",
+			want:     "docker.io/library/busybox:1.36",
+			pullable: "docker.io/library/busybox:1.36",
+		},
+		{
+			name:     "registryWithPort",
+			image:    "localhost:5000/team/app",
+			want:     "localhost:5000/team/app:latest",
+			pullable: "localhost:5000/team/app:latest",
+		},
+		{
+			name:     "tagWithDigest",
+			image:    "registry.k8s.io/ingress-nginx/kube-webhook-certgen:v20230407@sha256:543c40fd093964bc9ab509d3e791f9989963021f1e9e4c9c7b6700b02bfb227b",
+			want:     "registry.k8s.io/ingress-nginx/kube-webhook-certgen:v20230407@sha256:543c40fd093964bc9ab509d3e791f9989963021f1e9e4c9c7b6700b02bfb227b",
+			pullable: "registry.k8s.io/ingress-nginx/kube-webhook-certgen@sha256:543c40fd093964bc9ab509d3e791f9989963021f1e9e4c9c7b6700b02bfb227b",
+		},
+		{
+			name:    "invalidRepository",
+			image:   "docker.io/Nginx",
+			wantErr: true,
+		},
+		{
+			name:    "invalidDigest",
+			image:   "nginx@sha256:123",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := image.ParseReference(tt.image)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReference() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if got := ref.String(); got != tt.want {
+				t.Errorf("String() = %v, want %v", got, tt.want)
+			}
+
+			if got := ref.Pullable(); got != tt.pullable {
+				t.Errorf("Pullable() = %v, want %v", got, tt.pullable)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics exposes the internal metrics of HPK in the Prometheus format.
+package metrics
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "hpk"
+
+// Registry holds the metrics of HPK. It is separate from the default registry of Prometheus,
+// so that the metrics of the imported libraries are not exposed unintentionally.
+var Registry = prometheus.NewRegistry()
+
+/*---------------------------------------------------
+ * Slurm
+ *---------------------------------------------------*/
+var (
+	// SlurmCommandDuration is the latency of the Slurm CLI (e.g, sbatch, scancel), by command and result.
+	SlurmCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "slurm",
+		Name:      "command_duration_seconds",
+		Help:      "Latency of the Slurm commands.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"command", "result"})
+
+	// JobsSubmitted is the number of jobs that have been submitted to Slurm.
+	JobsSubmitted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "slurm",
+		Name:      "jobs_submitted_total",
+		Help:      "Number of jobs submitted to Slurm.",
+	})
+
+	// JobsCancelled is the number of jobs that have been cancelled in Slurm.
+	JobsCancelled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "slurm",
+		Name:      "jobs_cancelled_total",
+		Help:      "Number of jobs cancelled in Slurm.",
+	})
+)
+
+/*---------------------------------------------------
+ * Events
+ *---------------------------------------------------*/
+var (
+	// EventQueueLength is the number of filesystem events that wait to be handled.
+	EventQueueLength = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "queue_length",
+		Help:      "Number of Slurm events waiting in the queue of the event handler.",
+	})
+
+	// WatcherErrors is the number of errors reported by the filesystem watcher.
+	WatcherErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "watcher_errors_total",
+		Help:      "Number of errors reported by the filesystem watcher.",
+	})
+)
+
+/*---------------------------------------------------
+ * Pods
+ *---------------------------------------------------*/
+var (
+	// PodPhaseTransitions is the number of phase transitions of pods, as they are observed by HPK.
+	PodPhaseTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "pod",
+		Name:      "phase_transitions_total",
+		Help:      "Number of phase transitions of pods.",
+	}, []string{"from", "to"})
+
+	// PodErrors is the number of pods that have failed due to an error, by reason.
+	PodErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "pod",
+		Name:      "errors_total",
+		Help:      "Number of pods failed by HPK, by reason.",
+	}, []string{"reason"})
+
+	// SystemPanics is the number of unrecoverable errors of HPK. Since HPK exits upon such an error,
+	// the counter is kept across restarts (see PersistSystemPanics).
+	SystemPanics = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "system_panics_total",
+		Help:      "Number of system errors that caused HPK to panic.",
+	})
+)
+
+/*---------------------------------------------------
+ * Images
+ *---------------------------------------------------*/
+var (
+	// ImagesRemoved is the number of images that have been removed by the garbage collector.
+	ImagesRemoved = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "image",
+		Name:      "gc_removed_total",
+		Help:      "Number of images removed by the image garbage collector.",
+	})
+
+	// ImageGCReclaimedBytes is the estimated size of the images that have been removed by the garbage collector.
+	ImageGCReclaimedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "image",
+		Name:      "gc_reclaimed_bytes_total",
+		Help:      "Bytes reclaimed by the image garbage collector.",
+	})
+)
+
+/*---------------------------------------------------
+ * Pods per Phase
+ *---------------------------------------------------*/
+
+// PodCounter returns the number of pods in each phase.
+type PodCounter func() map[string]int
+
+// podsPerPhaseCollector counts the pods whenever the metrics are scraped, since the state of pods is kept
+// on the shared filesystem rather than in memory.
+type podsPerPhaseCollector struct {
+	desc *prometheus.Desc
+
+	lock    sync.RWMutex
+	counter PodCounter
+}
+
+var podsPerPhase = &podsPerPhaseCollector{
+	desc: prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pod", "phase_count"),
+		"Number of pods managed by HPK, by phase.",
+		[]string{"phase"}, nil,
+	),
+}
+
+// SetPodCounter sets the function that counts the pods per phase.
+func SetPodCounter(counter PodCounter) {
+	podsPerPhase.lock.Lock()
+	defer podsPerPhase.lock.Unlock()
+
+	podsPerPhase.counter = counter
+}
+
+func (c *podsPerPhaseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *podsPerPhaseCollector) Collect(ch chan<- prometheus.Metric) {
+	c.lock.RLock()
+	counter := c.counter
+	c.lock.RUnlock()
+
+	if counter == nil {
+		return
+	}
+
+	for phase, count := range counter() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), phase)
+	}
+}
+
+func init() {
+	Registry.MustRegister(
+		SlurmCommandDuration,
+		JobsSubmitted,
+		JobsCancelled,
+		EventQueueLength,
+		WatcherErrors,
+		PodPhaseTransitions,
+		PodErrors,
+		SystemPanics,
+		ImagesRemoved,
+		ImageGCReclaimedBytes,
+		podsPerPhase,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics of the registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveSlurmCommand records the latency of a Slurm command that started at the given time.
+func ObserveSlurmCommand(command string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	SlurmCommandDuration.WithLabelValues(filepath.Base(command), result).Observe(time.Since(start).Seconds())
+}
+
+// ObservePhaseTransition records the transition of a pod between two phases. Unchanged phases are ignored.
+func ObservePhaseTransition(from string, to string) {
+	if from == to {
+		return
+	}
+
+	if from == "" {
+		from = "None"
+	}
+
+	PodPhaseTransitions.WithLabelValues(from, to).Inc()
+}
+
+/*---------------------------------------------------
+ * Persistence of System Panics
+ *---------------------------------------------------*/
+var systemPanics struct {
+	lock  sync.Mutex
+	path  string
+	count uint64
+}
+
+// PersistSystemPanics restores the counter of system panics from the given file,
+// wherein it is written by RecordSystemPanic.
+func PersistSystemPanics(path string) error {
+	systemPanics.lock.Lock()
+	defer systemPanics.lock.Unlock()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		count, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid counter of system panics in '%s'", path)
+		}
+
+		SystemPanics.Add(float64(count))
+		systemPanics.count += count
+
+	case !errors.Is(err, os.ErrNotExist):
+		return errors.Wrapf(err, "cannot read the counter of system panics")
+	}
+
+	systemPanics.path = path
+
+	return nil
+}
+
+// RecordSystemPanic increments the counter of system panics, and writes it to disk before HPK exits.
+func RecordSystemPanic() {
+	systemPanics.lock.Lock()
+	defer systemPanics.lock.Unlock()
+
+	SystemPanics.Inc()
+	systemPanics.count++
+
+	if systemPanics.path == "" {
+		return
+	}
+
+	// the error is ignored, as HPK is already failing.
+	_ = os.WriteFile(systemPanics.path, []byte(strconv.FormatUint(systemPanics.count, 10)), 0o600)
+}
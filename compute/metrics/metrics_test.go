@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObservePhaseTransition(t *testing.T) {
+	ObservePhaseTransition("", "Pending")
+	ObservePhaseTransition("Pending", "Running")
+	ObservePhaseTransition("Running", "Running")
+
+	if got := testutil.ToFloat64(PodPhaseTransitions.WithLabelValues("None", "Pending")); got != 1 {
+		t.Errorf("expected 1 transition from None to Pending, got %v", got)
+	}
+
+	if got := testutil.ToFloat64(PodPhaseTransitions.WithLabelValues("Running", "Running")); got != 0 {
+		t.Errorf("unchanged phases should be ignored, got %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	SetPodCounter(func() map[string]int {
+		return map[string]int{"Running": 2, "Pending": 1}
+	})
+	defer SetPodCounter(nil)
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+
+	for _, want := range []string{
+		`hpk_pod_phase_count{phase="Running"} 2`,
+		`hpk_pod_phase_count{phase="Pending"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected '%s' in the metrics", want)
+		}
+	}
+}
+
+func TestPersistSystemPanics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".system_panics")
+
+	if err := os.WriteFile(path, []byte("2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	before := testutil.ToFloat64(SystemPanics)
+
+	if err := PersistSystemPanics(path); err != nil {
+		t.Fatal(err)
+	}
+
+	RecordSystemPanic()
+
+	if got := testutil.ToFloat64(SystemPanics) - before; got != 3 {
+		t.Errorf("expected 3 system panics, got %v", got)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "3" {
+		t.Errorf("expected 3 system panics on disk, got '%s'", data)
+	}
+}
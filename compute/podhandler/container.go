@@ -19,12 +19,14 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"unicode/utf8"
 
 	"github.com/carv-ics-forth/hpk/compute"
 	"github.com/carv-ics-forth/hpk/compute/endpoint"
-	"github.com/carv-ics-forth/hpk/compute/image"
 	"github.com/carv-ics-forth/hpk/compute/slurm"
 	kubecontainer "github.com/carv-ics-forth/hpk/pkg/container"
+	"github.com/carv-ics-forth/hpk/pkg/crdtools"
 	"github.com/carv-ics-forth/hpk/pkg/hostutil"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
@@ -131,14 +133,31 @@ func (h *podHandler) buildContainer(container *corev1.Container, containerStatus
 		binds[i] = hostPath + ":" + mount.MountPath + ":" + accessMode
 	}
 
+	/*---------------------------------------------------
+	 * Prepare Termination Message
+	 *---------------------------------------------------*/
+	// init containers run with apptainer, which binds /dev from the host, and the file cannot be bound into it.
+	// Their message can only fall back to the logs.
+	if container.TerminationMessagePath != "" && !isInitContainer(h.Pod, container.Name) {
+		terminationMessagePath := h.podDirectory.Container(container.Name).TerminationMessagePath()
+
+		// create the file in advance, so that the bind does not create a directory in its place.
+		if err := os.WriteFile(terminationMessagePath, []byte{}, endpoint.PodGlobalDirectoryPermissions); err != nil {
+			compute.SystemPanic(err, "cannot create termination message file for container '%s' of pod '%s'", container.Name, h.podKey)
+		}
+
+		binds = append(binds, terminationMessagePath+":"+container.TerminationMessagePath+":rw")
+	}
+
 	/*---------------------------------------------------
 	 * Prepare Container Image
 	 *---------------------------------------------------*/
-	containerID := fmt.Sprintf("%s_%s_%s", h.Pod.GetNamespace(), h.Pod.GetName(), container.Name)
+	containerID := instanceName(h.Pod, container.Name)
 
-	img, err := image.Pull(compute.HPK.ImageDir(), image.Docker, container.Image)
-	if err != nil {
-		compute.SystemPanic(err, "ImagePull error. Image:%s ", container.Image)
+	// the image has been pulled before the containers are built.
+	img, pulled := h.images[container.Image]
+	if !pulled {
+		return Container{}, errors.Errorf("image '%s' has not been pulled", container.Image)
 	}
 
 	// if there is no command, use the run mode, which will execute the runscript
@@ -157,7 +176,7 @@ func (h *podHandler) buildContainer(container *corev1.Container, containerStatus
 		InstanceName:  containerID,
 		RunAsUser:     uid,
 		RunAsGroup:    gid,
-		ImageName: img.ImageName,
+		ImageName:     img.ImageName,
 		EnvFilePath:   containerPath.EnvFilePath(),
 		Binds:         binds,
 		Command:       kubecontainer.ExpandContainerCommandOnlyStatic(container.Command, container.Env),
@@ -166,6 +185,17 @@ func (h *podHandler) buildContainer(container *corev1.Container, containerStatus
 		LogsPath:      containerPath.LogsPath(),
 		JobIDPath:     containerPath.IDPath(),
 		ExitCodePath:  containerPath.ExitCodePath(),
+		OOMKilledPath: containerPath.OOMKilledPath(),
+		StatsPath:     containerPath.StatsPath(),
+	}
+
+	// the terminal of an interactive container is bridged to its stdin, and it is meaningless without it.
+	if container.Stdin {
+		c.StdinPath = containerPath.StdinPath()
+
+		if container.TTY {
+			c.TTYPath = containerPath.TTYPath()
+		}
 	}
 
 	/*---------------------------------------------------
@@ -175,11 +205,43 @@ func (h *podHandler) buildContainer(container *corev1.Container, containerStatus
 	containerStatus.ContainerID = containerID
 
 	containerStatus.Image = container.Image
-	containerStatus.ImageID = img.ImageName
+	containerStatus.ImageID = img.ID()
+
+	h.logger.V(1).Info(" * Container has been materialized", "container", container.Name, "image", img.ImageName)
 
 	return c, nil
 }
 
+// instanceName is the name of the container within the runtime of the job. It is unique across pods.
+func instanceName(pod *corev1.Pod, containerName string) string {
+	return fmt.Sprintf("%s_%s_%s", pod.GetNamespace(), pod.GetName(), containerName)
+}
+
+// isInitContainer returns true if the container is an init container of the pod.
+func isInitContainer(pod *corev1.Pod, containerName string) bool {
+	for _, container := range pod.Spec.InitContainers {
+		if container.Name == containerName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// defaultContainer returns the name of the container that is selected by the DefaultContainerAnnotation,
+// or the first container of the pod.
+func defaultContainer(pod *corev1.Pod) string {
+	if name := pod.GetAnnotations()[DefaultContainerAnnotation]; name != "" {
+		for _, container := range pod.Spec.Containers {
+			if container.Name == name {
+				return name
+			}
+		}
+	}
+
+	return pod.Spec.Containers[0].Name
+}
+
 /*************************************************************
 
 		Load Container status from the FS
@@ -199,34 +261,49 @@ func SyncContainerStatuses(pod *corev1.Pod) {
 		exitCode, exitCodeExists := readIntFromFile(exitCodePath)
 
 		if exitCodeExists {
+			// the termination is recorded once, as the status is kept across the events of the pod.
+			if containerStatus.State.Terminated != nil {
+				return
+			}
+
 			// prepare some messages
 			var reason, message string
-			var restartCount int32
+			var signal int32
+
+			restartCount := containerStatus.RestartCount
 
 			if exitCode == 0 {
 				reason = "Completed"
 				message = "Container successfully terminated"
 			} else {
-				reason = "Error(" + containerStatus.Name + ")"
+				reason, signal = terminationReason(pod, podDir.Container(containerStatus.Name), exitCode)
 				message = HumanReadableCode(exitCode)
-				restartCount = containerStatus.RestartCount + 1
+
+				// the OOM events are accounted per job, and not per container.
+				if reason == "OOMKilled" {
+					message = "Killed (SIGKILL) while the OOM killer was active within the job, whose memory is shared by its containers"
+				}
+				restartCount++
+			}
+
+			if msg := terminationMessage(pod, containerStatus.Name, exitCode); msg != "" {
+				message = msg
+			}
+
+			var startedAt metav1.Time
+			if containerStatus.State.Running != nil {
+				startedAt = containerStatus.State.Running.StartedAt
 			}
 
 			// set current status to terminate.
 			containerStatus.State.Waiting = nil
 			containerStatus.State.Running = nil
 			containerStatus.State.Terminated = &corev1.ContainerStateTerminated{
-				ExitCode: int32(exitCode),
-				Signal:   0,
-				Reason:   reason,
-				Message:  message,
-				StartedAt: func() metav1.Time {
-					if containerStatus.State.Running != nil {
-						return containerStatus.State.Running.StartedAt
-					} else {
-						return metav1.Time{}
-					}
-				}(),
+				ExitCode:    int32(exitCode),
+				Signal:      signal,
+				Reason:      reason,
+				Message:     message,
+				StartedAt:   startedAt,
 				FinishedAt:  metav1.Now(), // fixme: get it from the file's ctime
 				ContainerID: containerStatus.ContainerID,
 			}
@@ -237,6 +314,14 @@ func SyncContainerStatuses(pod *corev1.Pod) {
 			// increase the restart counter.
 			containerStatus.RestartCount = restartCount
 
+			eventType := corev1.EventTypeNormal
+			if exitCode != 0 {
+				eventType = corev1.EventTypeWarning
+			}
+
+			compute.EventRecorder.Eventf(pod, eventType, compute.EventExited,
+				"Container %s exited with code %d (%s)", containerStatus.Name, exitCode, reason)
+
 			return
 		}
 
@@ -258,6 +343,9 @@ func SyncContainerStatuses(pod *corev1.Pod) {
 				started := true
 				containerStatus.Started = &started
 				containerStatus.Ready = true
+
+				compute.EventRecorder.Eventf(pod, corev1.EventTypeNormal, compute.EventStarted,
+					"Started container %s", containerStatus.Name)
 			}
 
 			return
@@ -283,3 +371,94 @@ func SyncContainerStatuses(pod *corev1.Pod) {
 		handleStatus(&pod.Status.ContainerStatuses[i])
 	}
 }
+
+// terminationReason classifies the termination of a failed container in the same way as the kubelet does.
+// Containers killed by SIGKILL while the OOM killer was active within the job are reported as "OOMKilled",
+// and every other failure as "Error".
+func terminationReason(pod *corev1.Pod, containerPath endpoint.ContainerPath, exitCode int) (reason string, signal int32) {
+	signal = ExitCodeSignal(exitCode)
+
+	/*-- The job has detected an OOM event within its cgroup --*/
+	if _, oomKilled := readStringFromFile(containerPath.OOMKilledPath()); oomKilled {
+		return "OOMKilled", signal
+	}
+
+	/*-- Slurm has killed the job for exceeding its memory limit --*/
+	if signal == int32(syscall.SIGKILL) && slurm.HasJobID(pod) {
+		state, err := slurm.JobState(slurm.GetJobID(pod))
+		if err != nil {
+			compute.DefaultLogger.Info("Cannot query Slurm accounting", "pod", client.ObjectKeyFromObject(pod), "err", err.Error())
+		} else if state == slurm.JobStateOutOfMemory {
+			return "OOMKilled", signal
+		}
+	}
+
+	return "Error", signal
+}
+
+// Limits for the termination message, as defined by the kubelet.
+const (
+	maxTerminationMessageLength    = 1024 * 4
+	maxTerminationMessageLogLength = 1024 * 2
+	maxTerminationMessageLogLines  = 80
+)
+
+// terminationMessage returns the message that a terminated container has written to its terminationMessagePath.
+// If the message is empty and the container has failed with a FallbackToLogsOnError policy,
+// the tail of the container logs is used instead.
+func terminationMessage(pod *corev1.Pod, containerName string, exitCode int) string {
+	container := crdtools.GetContainer(pod, containerName)
+	if container == nil || container.TerminationMessagePath == "" {
+		return ""
+	}
+
+	containerPath := compute.HPK.Pod(client.ObjectKeyFromObject(pod)).Container(containerName)
+
+	message, _ := readStringFromFile(containerPath.TerminationMessagePath())
+	message = truncateHead(message, maxTerminationMessageLength)
+
+	if message == "" && exitCode != 0 && container.TerminationMessagePolicy == corev1.TerminationMessageFallbackToLogsOnError {
+		logs, err := kubecontainer.GetRotatedTailLog(containerPath.LogsPath(), maxTerminationMessageLogLines)
+		if err != nil {
+			compute.DefaultLogger.Info("Cannot read the logs for the termination message", "path", containerPath.LogsPath(), "err", err.Error())
+
+			return ""
+		}
+
+		for i := range logs {
+			logs[i] = kubecontainer.LogMessage(logs[i])
+		}
+
+		message = truncateTail(strings.Join(logs, "\n"), maxTerminationMessageLogLength)
+	}
+
+	return message
+}
+
+// truncateHead keeps up to maxBytes from the beginning of the message, without splitting a UTF-8 character.
+func truncateHead(message string, maxBytes int) string {
+	if len(message) <= maxBytes {
+		return message
+	}
+
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(message[end]) {
+		end--
+	}
+
+	return message[:end]
+}
+
+// truncateTail keeps up to maxBytes from the end of the message, without splitting a UTF-8 character.
+func truncateTail(message string, maxBytes int) string {
+	if len(message) <= maxBytes {
+		return message
+	}
+
+	start := len(message) - maxBytes
+	for start < len(message) && !utf8.RuneStart(message[start]) {
+		start++
+	}
+
+	return message[start:]
+}
@@ -53,3 +53,31 @@ func Test_podHandler_buildContainer(t *testing.T) {
 
 	*/
 }
+
+func Test_truncateTerminationMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		maxBytes int
+		wantHead string
+		wantTail string
+	}{
+		{name: "short", message: "done", maxBytes: 8, wantHead: "done", wantTail: "done"},
+		{name: "ascii", message: "abcdef", maxBytes: 4, wantHead: "abcd", wantTail: "cdef"},
+		{name: "rune boundary", message: "αβγ", maxBytes: 4, wantHead: "αβ", wantTail: "βγ"},
+		{name: "split rune", message: "aαβb", maxBytes: 4, wantHead: "aα", wantTail: "βb"},
+		{name: "emoji", message: "😀😀", maxBytes: 5, wantHead: "😀", wantTail: "😀"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateHead(tt.message, tt.maxBytes); got != tt.wantHead {
+				t.Errorf("truncateHead(%q, %d) = %q, want %q", tt.message, tt.maxBytes, got, tt.wantHead)
+			}
+
+			if got := truncateTail(tt.message, tt.maxBytes); got != tt.wantTail {
+				t.Errorf("truncateTail(%q, %d) = %q, want %q", tt.message, tt.maxBytes, got, tt.wantTail)
+			}
+		})
+	}
+}
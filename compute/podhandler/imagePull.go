@@ -0,0 +1,250 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/image"
+	"github.com/carv-ics-forth/hpk/compute/tracing"
+	"github.com/pkg/errors"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Waiting reasons of the containers whose images are being pulled, as the kubelet reports them.
+const (
+	ReasonContainerCreating = "ContainerCreating"
+	ReasonErrImagePull      = "ErrImagePull"
+	ReasonImagePullBackOff  = "ImagePullBackOff"
+	ReasonErrImageNeverPull = "ErrImageNeverPull"
+	ReasonInvalidImageName  = "InvalidImageName"
+)
+
+// The delay before retrying a failed pull doubles after every failure, up to the maximum, as in the kubelet.
+var (
+	ImagePullBackOff    = 10 * time.Second
+	MaxImagePullBackOff = 5 * time.Minute
+)
+
+// imagePull pulls the images. It is replaced by tests.
+var imagePull = image.Pull
+
+// containerRef associates a container with its status.
+type containerRef struct {
+	container *corev1.Container
+	status    *corev1.ContainerStatus
+}
+
+/*
+pullImages pulls the images of all containers, before the job is submitted to Slurm.
+Meanwhile, the containers are Waiting, and every change of their status is saved and notified. Failed pulls
+are retried with exponential backoff, until they succeed or the pod is deleted (i.e, the context is cancelled).
+Pulls that cannot succeed (e.g, invalid name, or missing image with policy Never) leave the pod Pending.
+It returns false if the images are not available, or the pod has been deleted.
+*/
+func (h *podHandler) pullImages(ctx context.Context, notify func(*corev1.Pod)) bool {
+	/*---------------------------------------------------
+	 * Set the Containers as Waiting
+	 *---------------------------------------------------*/
+	h.Pod.Status.InitContainerStatuses = make([]corev1.ContainerStatus, len(h.Pod.Spec.InitContainers))
+	h.Pod.Status.ContainerStatuses = make([]corev1.ContainerStatus, len(h.Pod.Spec.Containers))
+
+	var containers []containerRef
+
+	for i := range h.Pod.Spec.InitContainers {
+		containers = append(containers, containerRef{&h.Pod.Spec.InitContainers[i], &h.Pod.Status.InitContainerStatuses[i]})
+	}
+
+	for i := range h.Pod.Spec.Containers {
+		containers = append(containers, containerRef{&h.Pod.Spec.Containers[i], &h.Pod.Status.ContainerStatuses[i]})
+	}
+
+	for _, c := range containers {
+		c.status.Name = c.container.Name
+		c.status.Image = c.container.Image
+		c.status.State = corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: ReasonContainerCreating},
+		}
+	}
+
+	h.Pod.Status.Phase = corev1.PodPending
+	h.Pod.Status.Reason = ReasonContainerCreating
+	h.Pod.Status.Message = "Pulling container images"
+
+	h.saveAndNotify(ctx, notify)
+
+	/*---------------------------------------------------
+	 * Pull the Images, once per distinct image
+	 *---------------------------------------------------*/
+	h.images = make(map[string]*image.Image)
+
+	for _, c := range containers {
+		if _, pulled := h.images[c.container.Image]; pulled {
+			continue
+		}
+
+		// the containers that share the image share its status.
+		var statuses []*corev1.ContainerStatus
+
+		for _, other := range containers {
+			if other.container.Image == c.container.Image {
+				statuses = append(statuses, other.status)
+			}
+		}
+
+		img, ok := h.pullImageWithBackOff(ctx, c.container, statuses, notify)
+		if !ok {
+			return false
+		}
+
+		h.images[c.container.Image] = img
+	}
+
+	h.Pod.Status.Message = "Container images are ready"
+
+	return true
+}
+
+// pullImageWithBackOff retries the pull of the container image, until it succeeds or it cannot succeed.
+func (h *podHandler) pullImageWithBackOff(ctx context.Context, container *corev1.Container,
+	statuses []*corev1.ContainerStatus, notify func(*corev1.Pod),
+) (*image.Image, bool) {
+	backOff := ImagePullBackOff
+
+	for failures := 0; ; failures++ {
+		img, err := h.pullImage(ctx, container)
+
+		// the pod has been deleted during the pull.
+		if ctx.Err() != nil {
+			h.logger.Info("Image pull has been cancelled", "image", container.Image)
+
+			return nil, false
+		}
+
+		if err == nil {
+			return img, true
+		}
+
+		switch {
+		case errors.Is(err, image.ErrInvalidImageName):
+			compute.EventRecorder.Eventf(h.Pod, corev1.EventTypeWarning, compute.EventInspectFailed,
+				"Failed to apply default image tag \"%s\": %s", container.Image, err)
+
+			h.setWaiting(statuses, ReasonInvalidImageName, err.Error())
+			h.saveAndNotify(ctx, notify)
+
+			return nil, false
+
+		case errors.Is(err, image.ErrImageNeverPull):
+			compute.EventRecorder.Eventf(h.Pod, corev1.EventTypeWarning, compute.EventErrImageNeverPull,
+				"Container image \"%s\" is not present with pull policy of Never", container.Image)
+
+			h.setWaiting(statuses, ReasonErrImageNeverPull, err.Error())
+			h.saveAndNotify(ctx, notify)
+
+			return nil, false
+		}
+
+		h.logger.Error(err, "image pull has failed", "image", container.Image, "retryIn", backOff)
+
+		compute.EventRecorder.Eventf(h.Pod, corev1.EventTypeWarning, compute.EventFailedPull,
+			"Failed to pull image \"%s\": %s", container.Image, err)
+
+		/*-- the first failure is reported as ErrImagePull, and the next ones as ImagePullBackOff --*/
+		if failures == 0 {
+			h.setWaiting(statuses, ReasonErrImagePull, err.Error())
+		} else {
+			compute.EventRecorder.Eventf(h.Pod, corev1.EventTypeNormal, compute.EventBackOff,
+				"Back-off pulling image \"%s\"", container.Image)
+
+			h.setWaiting(statuses, ReasonImagePullBackOff,
+				fmt.Sprintf("Back-off %s pulling image \"%s\": %s", backOff, container.Image, err))
+		}
+
+		h.saveAndNotify(ctx, notify)
+
+		select {
+		case <-ctx.Done():
+			h.logger.Info("Image pull has been cancelled", "image", container.Image)
+
+			return nil, false
+		case <-time.After(backOff):
+		}
+
+		backOff *= 2
+		if backOff > MaxImagePullBackOff {
+			backOff = MaxImagePullBackOff
+		}
+	}
+}
+
+// pullImage makes a single attempt to pull the image of the container.
+func (h *podHandler) pullImage(ctx context.Context, container *corev1.Container) (*image.Image, error) {
+	compute.EventRecorder.Eventf(h.Pod, corev1.EventTypeNormal, compute.EventPulling, "Pulling image \"%s\"", container.Image)
+
+	pullStart := time.Now()
+
+	_, span := tracing.Tracer().Start(ctx, "PullImage", trace.WithAttributes(
+		semconv.K8SContainerNameKey.String(container.Name),
+		semconv.ContainerImageNameKey.String(container.Image),
+	))
+
+	img, err := imagePull(ctx, compute.HPK.ImageDir(), image.Docker, container.Image, image.PullOptions{
+		Policy:  container.ImagePullPolicy,
+		Keyring: h.pullKeyring,
+	})
+	tracing.EndSpan(span, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	compute.EventRecorder.Eventf(h.Pod, corev1.EventTypeNormal, compute.EventPulled,
+		"Successfully pulled image \"%s\" in %s", container.Image, time.Since(pullStart).Round(time.Millisecond))
+
+	return img, nil
+}
+
+func (h *podHandler) setWaiting(statuses []*corev1.ContainerStatus, reason string, message string) {
+	for _, status := range statuses {
+		status.State = corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: message},
+		}
+	}
+}
+
+// saveAndNotify persists the status of the pod, and propagates it to Kubernetes. Deleted pods are ignored.
+func (h *podHandler) saveAndNotify(ctx context.Context, notify func(*corev1.Pod)) {
+	if !h.creation.lockUnlessCancelled(ctx) {
+		return
+	}
+
+	err := SavePodToFile(ctx, h.Pod)
+
+	h.creation.lock.Unlock()
+
+	if err != nil {
+		compute.SystemPanic(err, "failed to persistent pod")
+	}
+
+	if notify != nil {
+		notify(h.Pod.DeepCopy())
+	}
+}
@@ -0,0 +1,98 @@
+package podhandler
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/compute/image"
+	"github.com/fsnotify/fsnotify"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// noopWatcher is a watcher without any watched path.
+type noopWatcher struct{}
+
+func (noopWatcher) Events() <-chan fsnotify.Event { return nil }
+func (noopWatcher) Errors() <-chan error          { return nil }
+func (noopWatcher) Add(string) error              { return nil }
+func (noopWatcher) Remove(string) error           { return nil }
+func (noopWatcher) Close() error                  { return nil }
+
+func TestDeletePodDuringImagePull(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pulling"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "main", Image: "nginx:1.25"}},
+		},
+	}
+
+	podKey := client.ObjectKeyFromObject(pod)
+
+	if err := os.MkdirAll(compute.HPK.Pod(podKey).JobDir(), endpoint.PodGlobalDirectoryPermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	/*-- the pull blocks until it is killed --*/
+	pullStarted := make(chan struct{})
+
+	imagePull = func(ctx context.Context, _ string, _ image.Transport, _ string, _ image.PullOptions) (*image.Image, error) {
+		close(pullStarted)
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	}
+	defer func() { imagePull = image.Pull }()
+
+	ctx, creation, endCreation := beginCreation(context.Background(), podKey)
+	defer endCreation()
+
+	h := &podHandler{
+		Pod:          pod,
+		podKey:       podKey,
+		podDirectory: compute.HPK.Pod(podKey),
+		logger:       compute.DefaultLogger,
+		creation:     creation,
+	}
+
+	pulled := make(chan bool)
+
+	go func() {
+		pulled <- h.pullImages(ctx, nil)
+	}()
+
+	select {
+	case <-pullStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the image pull has not started")
+	}
+
+	if !DeletePod(podKey, noopWatcher{}) {
+		t.Fatal("failed to delete the pod")
+	}
+
+	select {
+	case ok := <-pulled:
+		if ok {
+			t.Fatal("the images of a deleted pod are reported as available")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the image pull has not been cancelled")
+	}
+
+	/*-- the creation makes no changes to the directory of the deleted pod --*/
+	if !creation.lockUnlessCancelled(ctx) {
+		if _, err := os.Stat(compute.HPK.Pod(podKey).String()); !os.IsNotExist(err) {
+			t.Fatalf("the directory of the deleted pod exists (err: %v)", err)
+		}
+
+		return
+	}
+
+	t.Fatal("the creation of a deleted pod can still submit its job")
+}
@@ -0,0 +1,130 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	kubecontainer "github.com/carv-ics-forth/hpk/pkg/container"
+	"github.com/carv-ics-forth/hpk/pkg/filenotify"
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+/*
+AttachToContainer attaches the streams of the caller to the main process of a running container.
+
+The output is followed from the logs of the container, starting from the moment of the attachment.
+Interactive containers (stdin: true) read their input from a FIFO in the pod directory. Because the FIFO
+is local to the compute node, the input is written by a new step of the pod's Slurm job. Likewise, the
+pseudo-terminal of containers with tty: true is resized by a step of the job.
+
+The attachment lasts until the container terminates, or until the caller disconnects.
+*/
+func AttachToContainer(ctx context.Context, podKey client.ObjectKey, containerName string, streams process.Streams, watcher filenotify.FileWatcher) error {
+	logger := compute.DefaultLogger.WithValues("pod", podKey, "container", containerName)
+
+	pod, container, err := lookupRunningContainer(podKey, containerName, "attach")
+	if err != nil {
+		return err
+	}
+
+	containerPath := compute.HPK.Pod(podKey).Container(containerName)
+	jobID := slurm.GetJobID(pod)
+
+	// the helper steps are terminated along with the attachment.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	/*---------------------------------------------------
+	 * Forward the Input to the Container
+	 *---------------------------------------------------*/
+	if streams.Stdin != nil && container.Stdin {
+		go func() {
+			input := process.Streams{Stdin: streams.Stdin}
+
+			if err := slurm.RunInJob(ctx, jobID, input, "sh", "-c", `cat > "$0"`, containerPath.StdinPath()); err != nil && ctx.Err() == nil {
+				logger.Error(err, "failed to forward stdin")
+			}
+		}()
+	}
+
+	/*---------------------------------------------------
+	 * Resize the Terminal of the Container
+	 *---------------------------------------------------*/
+	if streams.Resize != nil && container.TTY {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case size, ok := <-streams.Resize:
+					if !ok {
+						return
+					}
+
+					if err := resizeTerminal(ctx, jobID, containerPath.TTYPath(), size); err != nil && ctx.Err() == nil {
+						logger.Info("failed to resize terminal", "err", err.Error())
+					}
+				}
+			}
+		}()
+	}
+
+	/*---------------------------------------------------
+	 * Stream the Output of the Container
+	 *---------------------------------------------------*/
+	var offset int64
+
+	if info, err := os.Stat(containerPath.LogsPath()); err == nil {
+		offset = info.Size()
+	}
+
+	logs, err := kubecontainer.FollowFile(ctx, containerPath.LogsPath(), offset, containerPath.ExitCodePath(), watcher)
+	if err != nil {
+		return errors.Wrapf(err, "unable to stream logs")
+	}
+	defer logs.Close()
+
+	stderr := streams.Stderr
+	if streams.TTY {
+		// the terminal merges the streams of the container.
+		stderr = streams.Stdout
+	}
+
+	if err := kubecontainer.CopyLogs(logs, streams.Stdout, stderr); err != nil && ctx.Err() == nil {
+		return errors.Wrapf(err, "attachment has failed")
+	}
+
+	return nil
+}
+
+// resizeTerminal sets the size of the pseudo-terminal that the container runs in.
+// The terminal signals the change (SIGWINCH) to the runtime, which propagates it to the container.
+func resizeTerminal(ctx context.Context, jobID string, ttyPath string, size process.TerminalSize) error {
+	tty, err := os.ReadFile(ttyPath)
+	if err != nil {
+		return errors.Wrapf(err, "terminal is not allocated")
+	}
+
+	return slurm.RunInJob(ctx, jobID, process.Streams{}, "stty", "-F", strings.TrimSpace(string(tty)),
+		"rows", strconv.Itoa(int(size.Height)), "cols", strconv.Itoa(int(size.Width)))
+}
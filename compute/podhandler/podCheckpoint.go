@@ -0,0 +1,279 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	kubecontainer "github.com/carv-ics-forth/hpk/pkg/container"
+	"github.com/carv-ics-forth/hpk/pkg/crdtools"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// IsPreempted returns true if the job of the pod has received a termination warning, and it is being checkpointed.
+func IsPreempted(podKey client.ObjectKey) bool {
+	_, err := os.Stat(compute.HPK.Pod(podKey).PreemptedPath())
+
+	return err == nil
+}
+
+/*
+ResubmitPod submits a new job for a pod whose previous job has been checkpointed upon a termination warning.
+
+The containers of the previous job are reported as terminated (last state), their restart counters are increased,
+and the control files of the previous job are removed so that the new job drives again the lifecycle of the pod.
+If the job cannot be resubmitted, the pod is marked as Failed.
+*/
+func ResubmitPod(ctx context.Context, pod *corev1.Pod) {
+	podKey := client.ObjectKeyFromObject(pod)
+	podDir := compute.HPK.Pod(podKey)
+	logger := compute.DefaultLogger.WithValues("pod", podKey)
+
+	/*---------------------------------------------------
+	 * Ensure that the Pod is not being deleted
+	 *---------------------------------------------------*/
+	// The termination signal of scancel is also handled as a termination warning.
+	var remotePod corev1.Pod
+
+	if err := compute.K8SClient.Get(ctx, podKey, &remotePod); err != nil || remotePod.GetDeletionTimestamp() != nil {
+		logger.Info(" * Skip resubmission since pod is being deleted", "err", err)
+
+		return
+	}
+
+	checkpointCode, _ := readIntFromFile(podDir.CheckpointPath())
+	if checkpointCode != 0 {
+		compute.EventRecorder.Eventf(pod, corev1.EventTypeWarning, "CheckpointFailed",
+			"Checkpoint command exited with code %d", checkpointCode)
+	}
+
+	/*---------------------------------------------------
+	 * Keep the Last State of the Containers
+	 *---------------------------------------------------*/
+	SyncContainerStatuses(pod)
+
+	/*---------------------------------------------------
+	 * Remove the Control Files of the previous Job
+	 *---------------------------------------------------*/
+	controlFiles := []string{podDir.IPAddressPath(), podDir.PreemptedPath(), podDir.CheckpointPath()}
+
+	for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		containerPath := podDir.Container(container.Name)
+
+		controlFiles = append(controlFiles,
+			containerPath.IDPath(),
+			containerPath.ExitCodePath(),
+			containerPath.OOMKilledPath(),
+		)
+
+		// keep the logs of the previous run, as they are retrieved with 'kubectl logs --previous'.
+		if err := kubecontainer.RenameRotated(containerPath.LogsPath(), containerPath.PreviousLogsPath()); err != nil {
+			failResubmission(ctx, pod, errors.Wrapf(err, "failed to keep the previous logs of container '%s'", container.Name))
+
+			return
+		}
+
+		// the termination message file is bound to the container, and it must exist.
+		if container.TerminationMessagePath != "" {
+			if err := os.Truncate(containerPath.TerminationMessagePath(), 0); err != nil && !errors.Is(err, os.ErrNotExist) {
+				failResubmission(ctx, pod, errors.Wrapf(err, "failed to truncate termination message of container '%s'", container.Name))
+
+				return
+			}
+		}
+	}
+
+	for _, controlFile := range controlFiles {
+		if err := os.Remove(controlFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			failResubmission(ctx, pod, errors.Wrapf(err, "failed to remove control file '%s'", controlFile))
+
+			return
+		}
+	}
+
+	/*---------------------------------------------------
+	 * Resubmit the Job to Slurm
+	 *---------------------------------------------------*/
+	jobID, err := slurm.SubmitJob(podDir.SubmitJobPath())
+	if err != nil {
+		failResubmission(ctx, pod, errors.Wrapf(err, "failed to resubmit job"))
+
+		return
+	}
+
+	restartContainers(pod)
+
+	pod.Status.PodIP = ""
+	pod.Status.PodIPs = nil
+
+	slurm.SetPodID(pod, slurm.JobIDTypeSlurm, jobID)
+
+	message := fmt.Sprintf("Job is resubmitted as '%s' after preemption", jobID)
+
+	setPreemptedCondition(pod, true, "Resubmitted", message)
+
+	compute.EventRecorder.Event(pod, corev1.EventTypeNormal, "Resubmitted", message)
+
+	logger.Info(" * Slurm job has been resubmitted", "jobID", jobID)
+
+	if err := SavePodToFile(ctx, pod); err != nil {
+		compute.SystemPanic(err, "failed to persistent pod")
+	}
+}
+
+/*
+failResubmission marks as Failed a pod whose job cannot be resubmitted. Its containers are reported as terminated,
+with the state they had when the previous job was checkpointed.
+*/
+func failResubmission(ctx context.Context, pod *corev1.Pod, err error) {
+	compute.DefaultLogger.Error(err, "Resubmission has failed", "pod", client.ObjectKeyFromObject(pod))
+
+	compute.EventRecorder.Event(pod, corev1.EventTypeWarning, "ResubmissionFailed", err.Error())
+
+	terminateContainers(pod)
+
+	compute.PodError(pod, "ResubmissionFailed", "%s", err)
+
+	setPreemptedCondition(pod, false, "ResubmissionFailed", err.Error())
+
+	if err := SavePodToFile(ctx, pod); err != nil {
+		compute.SystemPanic(err, "failed to persistent pod")
+	}
+}
+
+// preemptedState returns the state of a container that has been stopped by the checkpoint handler,
+// or nil if the container has not started.
+func preemptedState(containerStatus *corev1.ContainerStatus) *corev1.ContainerStateTerminated {
+	if containerStatus.State.Terminated != nil {
+		return containerStatus.State.Terminated
+	}
+
+	if containerStatus.State.Running == nil {
+		return nil
+	}
+
+	// containers that were terminated by the checkpoint handler may have not reported their exit code.
+	return &corev1.ContainerStateTerminated{
+		ExitCode:    128 + int32(syscall.SIGTERM),
+		Signal:      int32(syscall.SIGTERM),
+		Reason:      "Preempted",
+		Message:     "Container is terminated after preemption",
+		StartedAt:   containerStatus.State.Running.StartedAt,
+		FinishedAt:  metav1.Now(),
+		ContainerID: containerStatus.ContainerID,
+	}
+}
+
+/*
+restartContainers sets as Waiting the containers that have started in the previous job, and keeps their
+last state. The restart counter of a container is increased once, as the failed containers are already
+counted by SyncContainerStatuses.
+*/
+func restartContainers(pod *corev1.Pod) {
+	restart := func(containerStatus *corev1.ContainerStatus) {
+		lastState := preemptedState(containerStatus)
+		if lastState == nil {
+			return
+		}
+
+		if containerStatus.State.Terminated == nil || containerStatus.State.Terminated.ExitCode == 0 {
+			containerStatus.RestartCount++
+		}
+
+		containerStatus.LastTerminationState = corev1.ContainerState{Terminated: lastState}
+
+		containerStatus.State = corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{
+				Reason:  "InSlurmQueue",
+				Message: "Job is resubmitted after preemption",
+			},
+		}
+		containerStatus.Ready = false
+		containerStatus.Started = nil
+	}
+
+	for i := 0; i < len(pod.Status.InitContainerStatuses); i++ {
+		restart(&pod.Status.InitContainerStatuses[i])
+	}
+
+	for i := 0; i < len(pod.Status.ContainerStatuses); i++ {
+		restart(&pod.Status.ContainerStatuses[i])
+	}
+}
+
+// terminateContainers sets as Terminated the containers that have started in the previous job.
+func terminateContainers(pod *corev1.Pod) {
+	terminate := func(containerStatus *corev1.ContainerStatus) {
+		lastState := preemptedState(containerStatus)
+		if lastState == nil {
+			return
+		}
+
+		containerStatus.State = corev1.ContainerState{Terminated: lastState}
+		containerStatus.LastTerminationState = containerStatus.State
+		containerStatus.Ready = false
+	}
+
+	for i := 0; i < len(pod.Status.InitContainerStatuses); i++ {
+		terminate(&pod.Status.InitContainerStatuses[i])
+	}
+
+	for i := 0; i < len(pod.Status.ContainerStatuses); i++ {
+		terminate(&pod.Status.ContainerStatuses[i])
+	}
+}
+
+/*
+isRestartedAfterPreemption returns true if the resubmitted job of a preempted pod has started its containers,
+i.e, their control files reappear after they have been removed by ResubmitPod.
+*/
+func isRestartedAfterPreemption(pod *corev1.Pod) bool {
+	if !crdtools.IsStatusConditionTrue(pod.Status.Conditions, PodPreempted) {
+		return false
+	}
+
+	podDir := compute.HPK.Pod(client.ObjectKeyFromObject(pod))
+
+	for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		if _, err := os.Stat(podDir.Container(container.Name).IDPath()); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func setPreemptedCondition(pod *corev1.Pod, preempted bool, reason string, message string) {
+	status := corev1.ConditionFalse
+	if preempted {
+		status = corev1.ConditionTrue
+	}
+
+	crdtools.SetPodStatusCondition(&pod.Status.Conditions, corev1.PodCondition{
+		Type:               PodPreempted,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	})
+}
@@ -0,0 +1,94 @@
+package podhandler
+
+import (
+	"os"
+	"testing"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func Test_restartContainers(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "preempted"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "failed"}, {Name: "completed"}, {Name: "running"}, {Name: "waiting"}},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "failed", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				{Name: "completed", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				{Name: "running", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				{Name: "waiting"},
+			},
+		},
+	}
+
+	podDir := compute.HPK.Pod(client.ObjectKeyFromObject(pod))
+
+	/*-- the checkpoint has terminated the containers, and some of them have reported their exit code --*/
+	exitCodes := map[string]string{"failed": "143", "completed": "0", "running": "", "waiting": ""}
+
+	if err := os.MkdirAll(podDir.ControlFileDir(), endpoint.PodGlobalDirectoryPermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(podDir.String())
+
+	for name, exitCode := range exitCodes {
+		containerPath := podDir.Container(name)
+
+		if name == "running" {
+			if err := os.WriteFile(containerPath.IDPath(), []byte("1234"), endpoint.PodSpecJsonFilePermissions); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if exitCode != "" {
+			if err := os.WriteFile(containerPath.ExitCodePath(), []byte(exitCode), endpoint.PodSpecJsonFilePermissions); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	SyncContainerStatuses(pod)
+	restartContainers(pod)
+
+	tests := []struct {
+		name             string
+		wantRestartCount int32
+		wantLastExitCode int32
+		wantLastState    bool
+	}{
+		{name: "failed", wantRestartCount: 1, wantLastExitCode: 143, wantLastState: true},
+		{name: "completed", wantRestartCount: 1, wantLastExitCode: 0, wantLastState: true},
+		{name: "running", wantRestartCount: 1, wantLastExitCode: 143, wantLastState: true},
+		{name: "waiting", wantRestartCount: 0, wantLastState: false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := pod.Status.ContainerStatuses[i]
+
+			if status.RestartCount != tt.wantRestartCount {
+				t.Errorf("RestartCount = %d, want %d", status.RestartCount, tt.wantRestartCount)
+			}
+
+			lastState := status.LastTerminationState.Terminated
+			if (lastState != nil) != tt.wantLastState {
+				t.Fatalf("LastTerminationState = %v, want %v", lastState, tt.wantLastState)
+			}
+
+			if lastState != nil && lastState.ExitCode != tt.wantLastExitCode {
+				t.Errorf("LastTerminationState.ExitCode = %d, want %d", lastState.ExitCode, tt.wantLastExitCode)
+			}
+
+			if tt.wantLastState && status.State.Waiting == nil {
+				t.Errorf("State = %v, want Waiting", status.State)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/pkg/archive"
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	utilexec "k8s.io/utils/exec"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// copyOperation is an operation of kubectl cp, which kubectl runs as an exec into the container.
+type copyOperation int
+
+const (
+	// copyFrom archives a path of the container (tar cf - <path>).
+	copyFrom copyOperation = iota + 1
+
+	// copyTo extracts an archive into a directory of the container (tar -xmf - -C <dir>).
+	copyTo
+
+	// copyCheckDir checks whether the destination is a directory (test -d <path>).
+	copyCheckDir
+)
+
+/*
+parseCopyCommand recognizes the commands of kubectl cp, and returns the operation and the path in the container.
+See https://github.com/kubernetes/kubectl/blob/master/pkg/cmd/cp/cp.go
+*/
+func parseCopyCommand(cmd []string) (copyOperation, string, bool) {
+	switch {
+	case len(cmd) == 4 && cmd[0] == "tar" && cmd[1] == "cf" && cmd[2] == "-":
+		return copyFrom, cmd[3], true
+
+	case len(cmd) == 3 && cmd[0] == "test" && cmd[1] == "-d":
+		return copyCheckDir, cmd[2], true
+
+	case len(cmd) > 0 && cmd[0] == "tar":
+		args := cmd[1:]
+
+		// kubectl cp --no-preserve
+		for len(args) > 0 && (args[0] == "--no-same-permissions" || args[0] == "--no-same-owner") {
+			args = args[1:]
+		}
+
+		if len(args) == 4 && args[0] == "-xmf" && args[1] == "-" && args[2] == "-C" {
+			return copyTo, args[3], true
+		}
+	}
+
+	return 0, "", false
+}
+
+/*
+volumeHostPath maps a path of the container to the host, if the path lies within an emptyDir or a PVC volume.
+The volumes are directories of the shared filesystem, and therefore they are accessible without entering the container.
+It returns the host path, the root of the volume, and whether the volume is mounted as read-only.
+*/
+func volumeHostPath(pod *corev1.Pod, container *corev1.Container, containerPath string) (string, string, bool, bool) {
+	if !path.IsAbs(containerPath) {
+		// relative paths depend on the working directory of the container.
+		return "", "", false, false
+	}
+
+	containerPath = path.Clean(containerPath)
+
+	/*-- find the innermost mount that contains the path --*/
+	var mount *corev1.VolumeMount
+
+	for i, m := range container.VolumeMounts {
+		mountPath := path.Clean(m.MountPath)
+
+		if containerPath != mountPath && !strings.HasPrefix(containerPath, strings.TrimSuffix(mountPath, "/")+"/") {
+			continue
+		}
+
+		if mount == nil || len(mountPath) > len(path.Clean(mount.MountPath)) {
+			mount = &container.VolumeMounts[i]
+		}
+	}
+
+	if mount == nil || mount.SubPathExpr != "" {
+		return "", "", false, false
+	}
+
+	/*-- only the volumes that hold their data on the shared filesystem --*/
+	supported := false
+
+	for _, vol := range pod.Spec.Volumes {
+		if vol.Name == mount.Name {
+			supported = vol.EmptyDir != nil || vol.PersistentVolumeClaim != nil
+
+			break
+		}
+	}
+
+	if !supported {
+		return "", "", false, false
+	}
+
+	root := filepath.Join(compute.HPK.Pod(client.ObjectKeyFromObject(pod)).VolumeDir(), mount.Name)
+
+	if mount.SubPath != "" {
+		root = filepath.Join(root, mount.SubPath)
+	}
+
+	rel := strings.TrimPrefix(strings.TrimPrefix(containerPath, path.Clean(mount.MountPath)), "/")
+
+	return filepath.Join(root, filepath.FromSlash(rel)), root, mount.ReadOnly, true
+}
+
+/*
+copyWithVolumes serves the commands of kubectl cp directly from the volumes of the pod, without running tar in the container.
+It returns false if the command is not served, and it should be executed in the container.
+*/
+func copyWithVolumes(pod *corev1.Pod, container *corev1.Container, cmd []string, streams process.Streams) (bool, error) {
+	op, containerPath, ok := parseCopyCommand(cmd)
+	if !ok {
+		return false, nil
+	}
+
+	hostPath, root, readOnly, ok := volumeHostPath(pod, container, containerPath)
+	if !ok {
+		return false, nil
+	}
+
+	switch op {
+	case copyCheckDir:
+		if info, err := os.Stat(hostPath); err != nil || !info.IsDir() {
+			return true, utilexec.CodeExitError{Err: errors.Errorf("'%s' is not a directory", containerPath), Code: 1}
+		}
+
+		return true, nil
+
+	case copyFrom:
+		if streams.Stdout == nil {
+			return true, errors.New("stdout is required to copy from the container")
+		}
+
+		// the path is checked before anything is written, and therefore the errors of tar can still be reported.
+		err := archive.Create(streams.Stdout, root, hostPath, containerPath)
+
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if streams.Stderr != nil {
+				_, _ = fmt.Fprintf(streams.Stderr, "tar: %s: Cannot stat: No such file or directory\n", containerPath)
+			}
+
+			return true, utilexec.CodeExitError{Err: err, Code: 2}
+
+		case errors.Is(err, archive.ErrOutsideRoot):
+			if streams.Stderr != nil {
+				_, _ = fmt.Fprintf(streams.Stderr, "tar: %s: Cannot open: Permission denied\n", containerPath)
+			}
+
+			return true, utilexec.CodeExitError{Err: err, Code: 2}
+		}
+
+		return true, err
+
+	case copyTo:
+		if streams.Stdin == nil {
+			return true, errors.New("stdin is required to copy into the container")
+		}
+
+		if readOnly {
+			return true, errors.Errorf("cannot copy into '%s': the volume is mounted as read-only", containerPath)
+		}
+
+		return true, archive.Extract(streams.Stdin, root, hostPath)
+	}
+
+	return false, nil
+}
+
+// copyError explains why a copy that is executed in the container has failed.
+func copyError(cmd []string, containerName string, err error) error {
+	op, containerPath, ok := parseCopyCommand(cmd)
+	if !ok || op == copyCheckDir {
+		return err
+	}
+
+	var exitErr utilexec.ExitError
+
+	// 126: the command is not executable, 127: the command is not found
+	if errors.As(err, &exitErr) && (exitErr.ExitStatus() == 126 || exitErr.ExitStatus() == 127) {
+		return errors.Errorf("cannot copy '%s': the path is inside the writable tmpfs of container '%s', "+
+			"which is local to the compute node and can only be copied with tar from the image. "+
+			"Use a path within an emptyDir or PersistentVolumeClaim volume instead", containerPath, containerName)
+	}
+
+	return err
+}
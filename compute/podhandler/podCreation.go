@@ -0,0 +1,91 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"context"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+/*
+A pod may be deleted while it is being created (e.g, while its images are being pulled). The creation is
+registered until the job ID is saved, so that DeletePod can cancel it. The changes that the creation makes to
+the pod directory (e.g, saving the pod, submitting the job) are serialized with the cancellation. Therefore,
+DeletePod either prevents the submission, or it finds the job ID and cancels the job.
+*/
+
+// creation is a pod whose creation is in progress.
+type creation struct {
+	lock   sync.Mutex
+	cancel context.CancelFunc
+}
+
+// creations holds the pods whose creation is in progress.
+var creations sync.Map // client.ObjectKey -> *creation
+
+/*
+beginCreation registers the creation of the pod. The returned context is cancelled if the pod is deleted, and
+the returned function must be called once the creation is completed.
+*/
+func beginCreation(ctx context.Context, podKey client.ObjectKey) (context.Context, *creation, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c := &creation{cancel: cancel}
+	creations.Store(podKey, c)
+
+	return ctx, c, func() {
+		if current, exists := creations.Load(podKey); exists && current == c {
+			creations.Delete(podKey)
+		}
+
+		cancel()
+	}
+}
+
+/*
+cancelCreation cancels the creation of the pod, and waits for the change in progress (e.g, the submission of the
+job) to complete. Afterwards, the creation makes no changes to the pod directory.
+*/
+func cancelCreation(podKey client.ObjectKey) {
+	value, exists := creations.LoadAndDelete(podKey)
+	if !exists {
+		return
+	}
+
+	c := value.(*creation)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.cancel()
+}
+
+/*
+lockUnlessCancelled acquires the creation for a change to the pod directory. It returns false if the pod has been
+deleted, in which case the lock is not acquired. Otherwise, the caller must release the lock.
+*/
+func (c *creation) lockUnlessCancelled(ctx context.Context) bool {
+	c.lock.Lock()
+
+	if ctx.Err() != nil {
+		c.lock.Unlock()
+
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,120 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"context"
+	"io/fs"
+	"os"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrContainerNotRunning is returned when a command cannot be executed in a container, because it is not running.
+var ErrContainerNotRunning = errors.New("container is not running")
+
+/*
+ExecInContainer runs a command within a running container of the pod, and streams its stdin/stdout/stderr.
+
+The command runs as a new step of the pod's Slurm job (srun --jobid --overlap), which enters the container
+via the runtime of the job (podman exec). Init containers run without a named instance, and therefore
+they do not support exec.
+
+The commands of kubectl cp on paths within emptyDir and PVC volumes are served directly from the shared filesystem,
+so that they work even for images without tar.
+*/
+func ExecInContainer(ctx context.Context, podKey client.ObjectKey, containerName string, cmd []string, streams process.Streams) error {
+	pod, container, err := lookupRunningContainer(podKey, containerName, "exec")
+	if err != nil {
+		return err
+	}
+
+	/*---------------------------------------------------
+	 * Serve kubectl cp from the Shared Filesystem
+	 *---------------------------------------------------*/
+	if served, err := copyWithVolumes(pod, container, cmd, streams); served {
+		return err
+	}
+
+	/*---------------------------------------------------
+	 * Run the Command as a Step of the Job
+	 *---------------------------------------------------*/
+	args := []string{compute.Environment.PodmanBin, "exec"}
+
+	if streams.Stdin != nil {
+		args = append(args, "--interactive")
+	}
+
+	if streams.TTY {
+		args = append(args, "--tty")
+	}
+
+	args = append(args, instanceName(pod, containerName))
+	args = append(args, cmd...)
+
+	return copyError(cmd, containerName, slurm.RunInJob(ctx, slurm.GetJobID(pod), streams, args...))
+}
+
+// lookupRunningContainer returns the pod and the spec of a regular container that currently runs within the job of the pod.
+func lookupRunningContainer(podKey client.ObjectKey, containerName string, operation string) (*corev1.Pod, *corev1.Container, error) {
+	pod, err := LoadPodFromKey(podKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var found *corev1.Container
+
+	for i, container := range pod.Spec.Containers {
+		if container.Name == containerName {
+			found = &pod.Spec.Containers[i]
+
+			break
+		}
+	}
+
+	if found == nil {
+		for _, container := range pod.Spec.InitContainers {
+			if container.Name == containerName {
+				return nil, nil, errors.Errorf("%s into init container '%s' is not supported", operation, containerName)
+			}
+		}
+
+		return nil, nil, errors.Wrapf(fs.ErrNotExist, "container '%s' is not found in pod '%s'", containerName, podKey)
+	}
+
+	/*---------------------------------------------------
+	 * Locate the Running Container
+	 *---------------------------------------------------*/
+	if !slurm.HasJobID(pod) {
+		return nil, nil, errors.Wrapf(ErrContainerNotRunning, "pod '%s' has not been submitted", podKey)
+	}
+
+	containerPath := compute.HPK.Pod(podKey).Container(containerName)
+
+	if _, err := os.Stat(containerPath.IDPath()); err != nil {
+		return nil, nil, errors.Wrapf(ErrContainerNotRunning, "container '%s' has not started", containerName)
+	}
+
+	if _, err := os.Stat(containerPath.ExitCodePath()); err == nil {
+		return nil, nil, errors.Wrapf(ErrContainerNotRunning, "container '%s' has terminated", containerName)
+	}
+
+	return pod, found, nil
+}
@@ -25,11 +25,15 @@ import (
 
 	"github.com/carv-ics-forth/hpk/compute"
 	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/compute/image"
 	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/carv-ics-forth/hpk/compute/tracing"
 	"github.com/carv-ics-forth/hpk/pkg/filenotify"
 	"github.com/carv-ics-forth/hpk/pkg/resources"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/json"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -38,8 +42,45 @@ import (
 const (
 	CustomSlurmFlags = "slurm.hpk.io/flags"
 	DefaultSlurmType = "slurm.hpk.io/type"
+
+	SlurmTimeLimit = "slurm.hpk.io/time-limit"
+	SlurmPartition = "slurm.hpk.io/partition"
+	SlurmPriority  = "slurm.hpk.io/priority"
+
+	// SlurmHold holds a queued job, or suspends a running job, while its value is "true".
+	SlurmHold = "slurm.hpk.io/hold"
+
+	// SlurmCheckpointCommand is invoked when Slurm warns the job for its termination (e.g, preemption).
+	// It runs within the default container of the pod (see DefaultContainerAnnotation), and once it completes,
+	// HPK resubmits the job for the same pod.
+	SlurmCheckpointCommand = "slurm.hpk.io/checkpoint-command"
+
+	// DefaultContainerAnnotation selects the default container of the pod, as it is used by kubectl.
+	DefaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
 )
 
+// Custom pod conditions.
+const (
+	// PodSuspended reflects whether the Slurm job is held or suspended.
+	PodSuspended corev1.PodConditionType = "slurm.hpk.io/Suspended"
+
+	// PodPreempted reflects whether the Slurm job has been preempted, and resubmitted after a checkpoint.
+	// It is cleared once the containers of the resubmitted job start.
+	PodPreempted corev1.PodConditionType = "slurm.hpk.io/Preempted"
+)
+
+// slurmJobAnnotations maps the annotations that can be changed while a job is queued
+// to the sbatch flag used upon submission, and to the job field used by 'scontrol update'.
+var slurmJobAnnotations = []struct {
+	Annotation string
+	Flag       string
+	JobField   string
+}{
+	{Annotation: SlurmTimeLimit, Flag: "--time", JobField: "TimeLimit"},
+	{Annotation: SlurmPartition, Flag: "--partition", JobField: "Partition"},
+	{Annotation: SlurmPriority, Flag: "--priority", JobField: "Priority"},
+}
+
 // LoadPodFromKey waits LoadPodFromFile with filePath discovery.
 func LoadPodFromKey(podRef client.ObjectKey) (*corev1.Pod, error) {
 	filePath := compute.HPK.Pod(podRef).EncodedJSONPath()
@@ -92,6 +133,35 @@ func SavePodToFile(_ context.Context, pod *corev1.Pod) error {
 	return nil
 }
 
+/*
+SavePodStatus persists the status of the pod, which is recalculated from the runtime, and keeps the rest of the
+local pod as is (e.g, the metadata that UpdatePod may have changed meanwhile). The file is replaced atomically,
+since it is read concurrently. It returns fs.ErrNotExist if the pod has been deleted.
+*/
+func SavePodStatus(_ context.Context, pod *corev1.Pod) error {
+	podRef := client.ObjectKeyFromObject(pod)
+
+	localPod, err := LoadPodFromKey(podRef)
+	if err != nil {
+		return err
+	}
+
+	localPod.Status = pod.Status
+
+	podDef, err := json.Marshal(localPod)
+	if err != nil {
+		return errors.Wrapf(err, "failed encoding pod")
+	}
+
+	filePath := compute.HPK.Pod(podRef).EncodedJSONPath()
+
+	if err := os.WriteFile(filePath+".tmp", podDef, endpoint.PodSpecJsonFilePermissions); err != nil {
+		return errors.Wrapf(err, "failed to write file path '%s'", filePath)
+	}
+
+	return os.Rename(filePath+".tmp", filePath)
+}
+
 /*
 DeletePod takes a Pod Reference and deletes the Pod from the provider.
 DeletePod may be called multiple times for the same pod.
@@ -103,6 +173,10 @@ Notice that by using the reference, we operate on the local copy instead of the
 func DeletePod(podKey client.ObjectKey, watcher filenotify.FileWatcher) bool {
 	logger := compute.DefaultLogger.WithValues("pod", podKey)
 
+	// if the pod is still being created, either its job is never submitted, or its job ID is saved.
+	cancelCreation(podKey)
+	forgetRejectedImages(podKey)
+
 	localPod, err := LoadPodFromKey(podKey)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
@@ -124,14 +198,14 @@ func DeletePod(podKey client.ObjectKey, watcher filenotify.FileWatcher) bool {
 		out, err := slurm.CancelJob(jodID)
 		if err != nil {
 			if errors.Is(err, slurm.ErrInvalidJob) {
-				logger.Info(" * No such Slurm job", "job", jodID, "pod", podKey)
+				logger.Info(" * No such Slurm job", "jobID", jodID)
 
 				// the job does not exist, so it can be considered as deleted.
 				goto remove_pod
 			}
 
 			if errors.Is(err, slurm.ErrRety) {
-				logger.Info(" * Slurm job cannot be deleted. Retry later", "job", jodID, "pod", podKey, "out", out)
+				logger.Info(" * Slurm job cannot be deleted. Retry later", "jobID", jodID, "out", out)
 
 				return false
 			}
@@ -139,7 +213,9 @@ func DeletePod(podKey client.ObjectKey, watcher filenotify.FileWatcher) bool {
 			compute.SystemPanic(err, "failed to cancel job '%s' (%s). out: '%s'", jodID, podKey, out)
 		}
 
-		logger.Info(" * Slurm job is cancelled", "job", jodID, "pod", podKey, "out", out)
+		logger.Info(" * Slurm job is cancelled", "jobID", jodID, "out", out)
+
+		compute.EventRecorder.Eventf(localPod, corev1.EventTypeNormal, compute.EventJobCancelled, "Cancelled Slurm job %s", jodID)
 	}
 
 	/*---------------------------------------------------
@@ -190,22 +266,44 @@ type podHandler struct {
 	podEnvVariables []corev1.EnvVar
 	podDirectory    endpoint.PodPath
 
+	// pullKeyring holds the credentials of imagePullSecrets. It is never persisted.
+	pullKeyring image.Keyring
+
+	// images are the pulled images of the containers, by container.Image.
+	images map[string]*image.Image
+
+	// creation serializes the changes of CreatePod with DeletePod.
+	creation *creation
+
 	logger logr.Logger
 }
 
-func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatcher) {
+func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatcher, notify func(*corev1.Pod)) {
 	/*---------------------------------------------------
 	 * Prepare the Pod Execution Environment
 	 *---------------------------------------------------*/
 	podKey := client.ObjectKeyFromObject(pod)
 	logger := compute.DefaultLogger.WithValues("pod", podKey)
 
+	ctx, span := tracing.Tracer().Start(ctx, "CreatePod", trace.WithAttributes(tracing.PodAttributes(pod)...))
+	defer func() {
+		if pod.Status.Phase == corev1.PodFailed {
+			span.SetStatus(codes.Error, pod.Status.Message)
+		}
+
+		span.End()
+	}()
+
+	ctx, creation, endCreation := beginCreation(ctx, podKey)
+	defer endCreation()
+
 	h := podHandler{
 		Pod:             pod,
 		podKey:          podKey,
 		podDirectory:    compute.HPK.Pod(podKey),
 		logger:          logger,
 		podEnvVariables: FromServices(ctx, pod.GetNamespace()),
+		creation:        creation,
 	}
 
 	// create directory for the job environment.
@@ -244,21 +342,47 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 	/*---------------------------------------------------
 	 * Mount Volumes
 	 *---------------------------------------------------*/
+	volumesCtx, volumesSpan := tracing.Tracer().Start(ctx, "MountVolumes")
+
 	for _, vol := range h.Pod.Spec.Volumes {
-		if err := h.mountVolumeSource(ctx, vol); err != nil {
+		if err := h.mountVolumeSource(volumesCtx, vol); err != nil {
+			tracing.EndSpan(volumesSpan, err)
+
+			compute.EventRecorder.Eventf(pod, corev1.EventTypeWarning, compute.EventFailedMount,
+				"Unable to mount volume '%s': %s", vol.Name, err)
+
 			compute.PodError(pod, "VolumeError", err.Error())
 
 			return
 		}
 	}
 
+	volumesSpan.End()
+
 	h.logger.Info(" * All volumes have been mounted")
 
+	if len(h.Pod.Spec.Volumes) > 0 {
+		compute.EventRecorder.Eventf(pod, corev1.EventTypeNormal, compute.EventVolumesMounted,
+			"Mounted %d volumes", len(h.Pod.Spec.Volumes))
+	}
+
+	/*---------------------------------------------------
+	 * Pull Container Images
+	 *---------------------------------------------------*/
+	h.pullKeyring = h.resolvePullSecrets(ctx)
+
+	if !h.pullImages(ctx, notify) {
+		logger.Info(" * Container images are not available. The job is not submitted")
+
+		return
+	}
+
+	logger.Info(" * All container images have been pulled")
+
 	/*---------------------------------------------------
 	 * Build Container Commands
 	 *---------------------------------------------------*/
 	var initContainers []Container
-	pod.Status.InitContainerStatuses = make([]corev1.ContainerStatus, len(pod.Spec.InitContainers))
 
 	for i := range pod.Spec.InitContainers {
 		initContainer := &pod.Spec.InitContainers[i]
@@ -275,7 +399,6 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 	}
 
 	var containers []Container
-	pod.Status.ContainerStatuses = make([]corev1.ContainerStatus, len(pod.Spec.Containers))
 
 	for i := range pod.Spec.Containers {
 		container := &pod.Spec.Containers[i]
@@ -367,13 +490,38 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 
 	logger.Info(" * Default Slurm Type has been set", "defaultFlag", totalFlags)
 
+	for _, mapping := range slurmJobAnnotations {
+		if value, ok := h.Pod.GetAnnotations()[mapping.Annotation]; ok && value != "" {
+			totalFlags = append(totalFlags, mapping.Flag+"="+value)
+		}
+	}
+
+	if isHeld(h.Pod.GetAnnotations()) {
+		totalFlags = append(totalFlags, "--hold")
+	}
+
 	if customflags, hasFlags := h.Pod.GetAnnotations()[CustomSlurmFlags]; hasFlags {
 		totalFlags = append(totalFlags, strings.Split(customflags, " ")...)
 	}
 
+	/*---------------------------------------------------
+	 * Stop if the Pod has been Deleted
+	 *---------------------------------------------------*/
+	// hold the creation until the job ID is saved, so that DeletePod either prevents the submission,
+	// or finds the job ID and cancels the job.
+	if !h.creation.lockUnlessCancelled(ctx) {
+		logger.Info(" * Pod has been deleted. The job is not submitted")
+
+		return
+	}
+
+	defer h.creation.lock.Unlock()
+
+	_, renderSpan := tracing.Tracer().Start(ctx, "RenderTemplate")
+
 	scriptTemplate, err := ParseTemplate(HostScriptTemplate)
 	if err != nil {
-		compute.SystemPanic(err, "sbatch template error", "template", HostScriptTemplate)
+		compute.SystemPanic(err, "sbatch template error")
 	}
 
 	scriptFileContent := bytes.Buffer{}
@@ -386,14 +534,20 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 			CgroupFilePath:      h.podDirectory.CgroupFilePath(),
 			ConstructorFilePath: h.podDirectory.ConstructorFilePath(),
 			IPAddressPath:       h.podDirectory.IPAddressPath(),
+			HostnamePath:        h.podDirectory.HostnamePath(),
 			StdoutPath:          h.podDirectory.StdoutPath(),
 			StderrPath:          h.podDirectory.StderrPath(),
 			SysErrorFilePath:    h.podDirectory.SysErrorFilePath(),
+			PreemptedPath:       h.podDirectory.PreemptedPath(),
+			CheckpointPath:      h.podDirectory.CheckpointPath(),
+			StatsPath:           h.podDirectory.StatsPath(),
 		},
-		InitContainers:  initContainers,
-		Containers:      containers,
-		ResourceRequest: resources.ResourceListToStruct(resourceRequest),
-		CustomFlags:     totalFlags,
+		InitContainers:      initContainers,
+		Containers:          containers,
+		ResourceRequest:     resources.ResourceListToStruct(resourceRequest),
+		CustomFlags:         totalFlags,
+		CheckpointCommand:   h.Pod.GetAnnotations()[SlurmCheckpointCommand],
+		CheckpointContainer: instanceName(h.Pod, defaultContainer(h.Pod)),
 	}); err != nil {
 		/*-- since both the template and fields are internal to the code, the evaluation should always succeed	--*/
 		compute.SystemPanic(err, "failed to evaluate sbatch template")
@@ -405,6 +559,8 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 		compute.SystemPanic(err, "unable to write sbatch script in file '%s'", scriptFilePath)
 	}
 
+	renderSpan.End()
+
 	logger.Info(" * Slurm script has been generated")
 
 	/*---------------------------------------------------
@@ -412,11 +568,24 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 	 *---------------------------------------------------*/
 	logger.Info("Script file path: ", "scriptFilePath", scriptFilePath)
 
+	_, submitSpan := tracing.Tracer().Start(ctx, "SubmitJob")
+
 	jobID, err := slurm.SubmitJob(scriptFilePath)
 	if err != nil {
 		compute.SystemPanic(err, "failed to submit job")
 	}
-	logger.Info(" * Slurm job has been submitted", "jobID", jobID)
+
+	submitSpan.SetAttributes(tracing.AttributeJobID.String(jobID))
+	submitSpan.End()
+
+	span.SetAttributes(tracing.AttributeJobID.String(jobID))
+
+	logger = logger.WithValues("jobID", jobID)
+	h.logger = logger
+
+	logger.Info(" * Slurm job has been submitted")
+
+	compute.EventRecorder.Eventf(h.Pod, corev1.EventTypeNormal, compute.EventJobSubmitted, "Submitted Slurm job %s", jobID)
 
 	// update pod with the slurm's job id
 	slurm.SetPodID(h.Pod, slurm.JobIDTypeSlurm, jobID)
@@ -424,6 +593,13 @@ func CreatePod(ctx context.Context, pod *corev1.Pod, watcher filenotify.FileWatc
 		compute.SystemPanic(err, "failed to set job id for pod")
 	}
 
+	if isHeld(h.Pod.GetAnnotations()) {
+		setSuspendedCondition(h.Pod, true, "Held", "the job is held in the Slurm queue")
+	}
+
+	// link the later events of the pod to this trace.
+	tracing.SetPodTraceContext(ctx, h.Pod)
+
 	// needed for subsequent GetPod()
 	if err := SavePodToFile(ctx, h.Pod); err != nil {
 		compute.SystemPanic(err, "failed to persistent pod")
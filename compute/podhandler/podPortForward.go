@@ -0,0 +1,55 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/pkg/portforward"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+/*
+PortForward connects the stream to a port of the pod.
+
+Pods run on the network of the compute nodes, so the connection is opened directly from the host of HPK
+to the IP of the pod, as it is recorded by the job.
+*/
+func PortForward(ctx context.Context, podKey client.ObjectKey, port int32, stream io.ReadWriteCloser) error {
+	pod, err := LoadPodFromKey(podKey)
+	if err != nil {
+		return err
+	}
+
+	if pod.Status.Phase != corev1.PodRunning {
+		return errors.Wrapf(ErrContainerNotRunning, "pod '%s' is in phase '%s'", podKey, pod.Status.Phase)
+	}
+
+	ip, ok := readStringFromFile(compute.HPK.Pod(podKey).IPAddressPath())
+	if !ok || strings.TrimSpace(ip) == "" {
+		return errors.Wrapf(ErrContainerNotRunning, "pod '%s' has no IP address", podKey)
+	}
+
+	address := net.JoinHostPort(strings.TrimSpace(ip), strconv.Itoa(int(port)))
+
+	return portforward.ForwardTo(ctx, address, stream)
+}
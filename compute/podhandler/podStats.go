@@ -0,0 +1,393 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	kubecontainer "github.com/carv-ics-forth/hpk/pkg/container"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
+	"golang.org/x/sys/unix"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxUsageAge is the age after which a sample is considered stale (e.g, the job has been killed).
+// The job samples the usage every 10 seconds.
+const maxUsageAge = time.Minute
+
+// Usage is a sample of resource usage, as it is written by the job.
+type Usage struct {
+	Time time.Time
+
+	// CPU is the cumulative CPU time, in nanoseconds.
+	CPU *uint64
+
+	// NanoCores is the rate of CPU usage since the previous sample.
+	NanoCores *uint64
+
+	// Memory is the working set of the pod, or the resident set of the container, in bytes.
+	Memory *uint64
+
+	// Network is the usage of the interfaces of the node. It is sampled only for pods.
+	Network *statsv1alpha1.InterfaceStats
+}
+
+/*
+ReadUsage reads the latest sample of resource usage from the file. The rate of CPU usage is computed from
+the previous sample, if it exists. Missing files, stale samples, and malformed samples are ignored.
+*/
+func ReadUsage(path string) (Usage, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Usage{}, false
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+
+	latest, ok := parseUsage(lines[len(lines)-1])
+	if !ok || time.Since(latest.Time) > maxUsageAge {
+		return Usage{}, false
+	}
+
+	if len(lines) > 1 {
+		previous, ok := parseUsage(lines[len(lines)-2])
+
+		if ok && previous.CPU != nil && latest.CPU != nil && *latest.CPU >= *previous.CPU && latest.Time.After(previous.Time) {
+			elapsed := latest.Time.Sub(previous.Time)
+			nanoCores := uint64(float64(*latest.CPU-*previous.CPU) / elapsed.Seconds())
+
+			latest.NanoCores = &nanoCores
+		}
+	}
+
+	return latest, true
+}
+
+// parseUsage parses a sample "<unix time in ns> <cpu usage in ns> <memory in bytes> [<rx bytes> <rx errors> <tx bytes> <tx errors>]".
+func parseUsage(line string) (Usage, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return Usage{}, false
+	}
+
+	timestamp, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Usage{}, false
+	}
+
+	usage := Usage{
+		Time:   time.Unix(0, timestamp),
+		CPU:    parseUint(fields[1]),
+		Memory: parseUint(fields[2]),
+	}
+
+	if len(fields) == 7 {
+		usage.Network = &statsv1alpha1.InterfaceStats{
+			RxBytes:  parseUint(fields[3]),
+			RxErrors: parseUint(fields[4]),
+			TxBytes:  parseUint(fields[5]),
+			TxErrors: parseUint(fields[6]),
+		}
+	}
+
+	return usage, true
+}
+
+// parseUint returns nil for the values that are unavailable ("-").
+func parseUint(field string) *uint64 {
+	value, err := strconv.ParseUint(field, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	return &value
+}
+
+/*
+GetPodStats builds the statistics of a running pod from the samples of its job, and from the usage of its
+directories on the shared filesystem.
+
+If the cgroup of the job cannot be sampled, the usage of the pod is the sum of its containers.
+*/
+func GetPodStats(pod *corev1.Pod) statsv1alpha1.PodStats {
+	podKey := client.ObjectKeyFromObject(pod)
+	podDir := compute.HPK.Pod(podKey)
+
+	stats := statsv1alpha1.PodStats{
+		PodRef: statsv1alpha1.PodReference{
+			Name:      pod.GetName(),
+			Namespace: pod.GetNamespace(),
+			UID:       string(pod.GetUID()),
+		},
+		StartTime: pod.GetCreationTimestamp(),
+	}
+
+	if pod.Status.StartTime != nil {
+		stats.StartTime = *pod.Status.StartTime
+	}
+
+	/*---------------------------------------------------
+	 * Container Statistics
+	 *---------------------------------------------------*/
+	var sumCPU, sumNanoCores, sumMemory uint64
+
+	var logsUsed uint64
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Running == nil {
+			continue
+		}
+
+		containerPath := podDir.Container(status.Name)
+
+		containerStats := statsv1alpha1.ContainerStats{
+			Name:      status.Name,
+			StartTime: status.State.Running.StartedAt,
+			Logs:      logsStats(containerPath.LogsPath()),
+		}
+
+		if containerStats.Logs != nil && containerStats.Logs.UsedBytes != nil {
+			logsUsed += *containerStats.Logs.UsedBytes
+		}
+
+		if usage, ok := ReadUsage(containerPath.StatsPath()); ok {
+			containerStats.CPU = cpuStats(usage)
+			containerStats.Memory = memoryStats(usage)
+
+			sumCPU += valueOf(usage.CPU)
+			sumNanoCores += valueOf(usage.NanoCores)
+			sumMemory += valueOf(usage.Memory)
+		}
+
+		stats.Containers = append(stats.Containers, containerStats)
+	}
+
+	/*---------------------------------------------------
+	 * Pod Statistics
+	 *---------------------------------------------------*/
+	usage, ok := ReadUsage(podDir.StatsPath())
+
+	if ok && usage.Network != nil {
+		stats.Network = &statsv1alpha1.NetworkStats{
+			Time:           metav1.NewTime(usage.Time),
+			InterfaceStats: *usage.Network,
+		}
+	}
+
+	if ok && usage.CPU != nil && usage.Memory != nil {
+		stats.CPU = cpuStats(usage)
+		stats.Memory = memoryStats(usage)
+	} else if len(stats.Containers) > 0 {
+		now := metav1.Now()
+
+		stats.CPU = &statsv1alpha1.CPUStats{Time: now, UsageCoreNanoSeconds: &sumCPU, UsageNanoCores: &sumNanoCores}
+		stats.Memory = &statsv1alpha1.MemoryStats{Time: now, WorkingSetBytes: &sumMemory, UsageBytes: &sumMemory}
+	}
+
+	/*---------------------------------------------------
+	 * Volume Statistics
+	 *---------------------------------------------------*/
+	ephemeralUsed := logsUsed
+
+	for _, vol := range pod.Spec.Volumes {
+		if vol.EmptyDir == nil && vol.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		fsStats := filesystemStats(filepath.Join(podDir.VolumeDir(), vol.Name), true)
+		if fsStats == nil {
+			continue
+		}
+
+		volumeStats := statsv1alpha1.VolumeStats{Name: vol.Name, FsStats: *fsStats}
+
+		if vol.PersistentVolumeClaim != nil {
+			volumeStats.PVCRef = &statsv1alpha1.PVCReference{
+				Name:      vol.PersistentVolumeClaim.ClaimName,
+				Namespace: pod.GetNamespace(),
+			}
+		} else if fsStats.UsedBytes != nil {
+			// emptyDir volumes count against the ephemeral storage of the pod.
+			ephemeralUsed += *fsStats.UsedBytes
+		}
+
+		stats.VolumeStats = append(stats.VolumeStats, volumeStats)
+	}
+
+	if ephemeral := filesystemStats(podDir.String(), false); ephemeral != nil {
+		ephemeral.UsedBytes = &ephemeralUsed
+		stats.EphemeralStorage = ephemeral
+	}
+
+	return stats
+}
+
+func cpuStats(usage Usage) *statsv1alpha1.CPUStats {
+	return &statsv1alpha1.CPUStats{
+		Time:                 metav1.NewTime(usage.Time),
+		UsageCoreNanoSeconds: usage.CPU,
+		UsageNanoCores:       usage.NanoCores,
+	}
+}
+
+func memoryStats(usage Usage) *statsv1alpha1.MemoryStats {
+	return &statsv1alpha1.MemoryStats{
+		Time:            metav1.NewTime(usage.Time),
+		UsageBytes:      usage.Memory,
+		WorkingSetBytes: usage.Memory,
+	}
+}
+
+// logsStats returns the usage of the logs of a container, including the rotated files.
+func logsStats(logsPath string) *statsv1alpha1.FsStats {
+	stats := filesystemStats(filepath.Dir(logsPath), false)
+	if stats == nil {
+		return nil
+	}
+
+	files, err := kubecontainer.RotatedFiles(logsPath)
+	if err != nil {
+		return nil
+	}
+
+	var used, inodes uint64
+
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			used += uint64(info.Size())
+			inodes++
+		}
+	}
+
+	stats.UsedBytes = &used
+	stats.InodesUsed = &inodes
+
+	return stats
+}
+
+/*
+filesystemStats returns the capacity of the filesystem that holds the path. If withUsage is set, it also returns
+the usage of the directory, which requires a walk over its contents.
+*/
+func filesystemStats(path string, withUsage bool) *statsv1alpha1.FsStats {
+	// the volumes of PVCs are links to the directories of their PVs.
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	var statfs unix.Statfs_t
+
+	if err := unix.Statfs(path, &statfs); err != nil {
+		return nil
+	}
+
+	blockSize := uint64(statfs.Bsize)
+	available := uint64(statfs.Bavail) * blockSize
+	capacity := uint64(statfs.Blocks) * blockSize
+	inodes := uint64(statfs.Files)
+	inodesFree := uint64(statfs.Ffree)
+
+	stats := &statsv1alpha1.FsStats{
+		Time:           metav1.Now(),
+		AvailableBytes: &available,
+		CapacityBytes:  &capacity,
+		Inodes:         &inodes,
+		InodesFree:     &inodesFree,
+	}
+
+	if withUsage {
+		used, inodesUsed := diskUsage(path)
+
+		stats.UsedBytes = &used
+		stats.InodesUsed = &inodesUsed
+	}
+
+	return stats
+}
+
+// diskUsageCacheTTL is how long the usage of a directory is cached, as walking the shared filesystem is expensive.
+const diskUsageCacheTTL = time.Minute
+
+type diskUsageEntry struct {
+	time   time.Time
+	used   uint64
+	inodes uint64
+}
+
+var (
+	diskUsageCache     = make(map[string]diskUsageEntry)
+	diskUsageCacheLock sync.Mutex
+)
+
+/*
+diskUsage returns the bytes and the inodes that are used by the contents of a directory, like du.
+The walk runs outside the lock, so that the usage of other directories is not blocked by a slow filesystem.
+*/
+func diskUsage(path string) (uint64, uint64) {
+	diskUsageCacheLock.Lock()
+	entry, ok := diskUsageCache[path]
+	diskUsageCacheLock.Unlock()
+
+	if ok && time.Since(entry.time) < diskUsageCacheTTL {
+		return entry.used, entry.inodes
+	}
+
+	entry = diskUsageEntry{time: time.Now()}
+
+	_ = filepath.WalkDir(path, func(_ string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			// the contents may change during the walk.
+			return nil
+		}
+
+		if info, err := dirEntry.Info(); err == nil {
+			entry.used += uint64(info.Size())
+			entry.inodes++
+		}
+
+		return nil
+	})
+
+	diskUsageCacheLock.Lock()
+	defer diskUsageCacheLock.Unlock()
+
+	// forget the directories of deleted pods.
+	for cached, old := range diskUsageCache {
+		if time.Since(old.time) > diskUsageCacheTTL {
+			delete(diskUsageCache, cached)
+		}
+	}
+
+	diskUsageCache[path] = entry
+
+	return entry.used, entry.inodes
+}
+
+func valueOf(value *uint64) uint64 {
+	if value == nil {
+		return 0
+	}
+
+	return *value
+}
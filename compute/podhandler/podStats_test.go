@@ -0,0 +1,142 @@
+package podhandler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_parseUsage(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantOK      bool
+		wantCPU     *uint64
+		wantMemory  *uint64
+		wantNetwork bool
+	}{
+		{name: "pod", line: "1700000000000000000 2000 3000 10 0 20 1", wantOK: true, wantCPU: uint64Ptr(2000), wantMemory: uint64Ptr(3000), wantNetwork: true},
+		{name: "container", line: "1700000000000000000 2000 3000", wantOK: true, wantCPU: uint64Ptr(2000), wantMemory: uint64Ptr(3000)},
+		{name: "unavailable", line: "1700000000000000000 - -", wantOK: true},
+		{name: "partial network", line: "1700000000000000000 2000 3000 10 0", wantOK: true, wantCPU: uint64Ptr(2000), wantMemory: uint64Ptr(3000)},
+		{name: "truncated", line: "1700000000000000000 2000", wantOK: false},
+		{name: "invalid time", line: "now 2000 3000", wantOK: false},
+		{name: "empty", line: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseUsage(tt.line)
+			if ok != tt.wantOK {
+				t.Fatalf("parseUsage(%q) ok = %v, want %v", tt.line, ok, tt.wantOK)
+			}
+
+			if !ok {
+				return
+			}
+
+			if !equalUint(got.CPU, tt.wantCPU) || !equalUint(got.Memory, tt.wantMemory) {
+				t.Errorf("parseUsage(%q) = cpu %v, memory %v, want %v, %v",
+					tt.line, got.CPU, got.Memory, tt.wantCPU, tt.wantMemory)
+			}
+
+			if (got.Network != nil) != tt.wantNetwork {
+				t.Errorf("parseUsage(%q) network = %v, want %v", tt.line, got.Network, tt.wantNetwork)
+			}
+		})
+	}
+}
+
+func TestReadUsage(t *testing.T) {
+	now := time.Now()
+
+	sample := func(at time.Time, cpu string) string {
+		return fmt.Sprintf("%d %s 1024\n", at.UnixNano(), cpu)
+	}
+
+	tests := []struct {
+		name          string
+		content       string
+		wantOK        bool
+		wantNanoCores *uint64
+	}{
+		{
+			name:          "two cores",
+			content:       sample(now.Add(-10*time.Second), "1000000000") + sample(now, "21000000000"),
+			wantOK:        true,
+			wantNanoCores: uint64Ptr(2000000000),
+		},
+		{
+			name:    "single sample",
+			content: sample(now, "1000000000"),
+			wantOK:  true,
+		},
+		{
+			name:    "counter reset",
+			content: sample(now.Add(-10*time.Second), "5000000000") + sample(now, "1000000000"),
+			wantOK:  true,
+		},
+		{
+			name:    "unavailable cpu",
+			content: sample(now.Add(-10*time.Second), "-") + sample(now, "1000000000"),
+			wantOK:  true,
+		},
+		{
+			name:    "malformed previous",
+			content: "garbage\n" + sample(now, "1000000000"),
+			wantOK:  true,
+		},
+		{
+			name:    "malformed latest",
+			content: sample(now, "1000000000") + "123",
+			wantOK:  false,
+		},
+		{
+			name:    "stale",
+			content: sample(now.Add(-2*maxUsageAge), "1000000000"),
+			wantOK:  false,
+		},
+		{
+			name:    "empty",
+			content: "",
+			wantOK:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pod.stats")
+
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := ReadUsage(path)
+			if ok != tt.wantOK {
+				t.Fatalf("ReadUsage() ok = %v, want %v", ok, tt.wantOK)
+			}
+
+			if !equalUint(got.NanoCores, tt.wantNanoCores) {
+				t.Errorf("ReadUsage() nanoCores = %v, want %v", valueOf(got.NanoCores), valueOf(tt.wantNanoCores))
+			}
+		})
+	}
+
+	if _, ok := ReadUsage(filepath.Join(t.TempDir(), "missing.stats")); ok {
+		t.Error("ReadUsage() of a missing file should not be ok")
+	}
+}
+
+func uint64Ptr(value uint64) *uint64 {
+	return &value
+}
+
+func equalUint(a *uint64, b *uint64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
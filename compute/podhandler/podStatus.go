@@ -23,6 +23,8 @@ import (
 	"strings"
 
 	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/metrics"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
 	"github.com/carv-ics-forth/hpk/pkg/crdtools"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
@@ -37,6 +39,12 @@ func UpdateStatusFromRuntime(pod *corev1.Pod) {
 	podDir := compute.HPK.Pod(podKey)
 	logger := compute.DefaultLogger.WithValues("pod", podKey)
 
+	// the status is persisted after every update (see SavePodStatus), and therefore each transition is observed once.
+	previousPhase := pod.Status.Phase
+	defer func() {
+		metrics.ObservePhaseTransition(string(previousPhase), string(pod.Status.Phase))
+	}()
+
 	/*---------------------------------------------------
 	 * Handle Initialization and Finals States
 	 *---------------------------------------------------*/
@@ -51,6 +59,18 @@ func UpdateStatusFromRuntime(pod *corev1.Pod) {
 		return
 	}
 
+	/*-- Before the job is submitted (e.g, while pulling images), the status is set by CreatePod --*/
+	if !slurm.HasJobID(pod) {
+		return
+	}
+
+	/*-- Termination warning of Slurm. The containers are being checkpointed --*/
+	if IsPreempted(podKey) {
+		setPreemptedCondition(pod, true, "Preempted", "Job has received a termination warning, and it is being checkpointed")
+	} else if isRestartedAfterPreemption(pod) {
+		setPreemptedCondition(pod, false, "Restarted", "Containers have restarted after preemption")
+	}
+
 	/*-- Initialization of virtual environment (e.g, sbatch code, IP, ...)  --*/
 	if pod.Status.PodIP == "" {
 		podIPPath := podDir.IPAddressPath()
@@ -333,6 +353,16 @@ func HumanReadableCode(code int) string {
 	}
 }
 
+// ExitCodeSignal returns the signal that terminated a process, following the shell convention that
+// a process killed by signal N exits with code 128+N. For any other exit code, it returns 0.
+func ExitCodeSignal(code int) int32 {
+	if code > 128 && code <= 128+64 {
+		return int32(code - 128)
+	}
+
+	return 0
+}
+
 func readStringFromFile(filepath string) (string, bool) {
 	out, err := os.ReadFile(filepath)
 	if os.IsNotExist(err) {
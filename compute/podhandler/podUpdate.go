@@ -0,0 +1,315 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/endpoint"
+	"github.com/carv-ics-forth/hpk/compute/slurm"
+	"github.com/carv-ics-forth/hpk/compute/tracing"
+	"github.com/carv-ics-forth/hpk/compute/volume/projected"
+	"github.com/carv-ics-forth/hpk/pkg/crdtools"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+/*
+UpdatePod applies the changes of a Kubernetes Pod to the local copy.
+
+Kubernetes permits updates only on metadata, container images, activeDeadlineSeconds, and tolerations.
+Labels and annotations are propagated to the downward API volumes, and changes on the Slurm annotations
+are applied to the queued job. Image updates cannot be applied to a running job, and are rejected with an event.
+
+UpdatePod returns true if the status of the local pod has changed, and therefore Kubernetes must be notified.
+*/
+func UpdatePod(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	podKey := client.ObjectKeyFromObject(pod)
+	logger := compute.DefaultLogger.WithValues("pod", podKey)
+
+	localPod, err := LoadPodFromKey(podKey)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to load pod")
+	}
+
+	oldPod := localPod.DeepCopy()
+
+	h := podHandler{
+		Pod:          localPod,
+		podKey:       podKey,
+		podDirectory: compute.HPK.Pod(podKey),
+		logger:       logger,
+	}
+
+	/*---------------------------------------------------
+	 * Merge the Metadata
+	 *---------------------------------------------------*/
+	localPod.SetLabels(pod.GetLabels())
+	localPod.SetAnnotations(pod.GetAnnotations())
+
+	// keep the local-only annotations, which never appear on the pods received from Kubernetes.
+	for _, key := range []string{slurm.JobIDAnnotation, tracing.TraceContextAnnotation} {
+		value, isSet := oldPod.GetAnnotations()[key]
+		if !isSet {
+			continue
+		}
+
+		annotations := localPod.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+
+		annotations[key] = value
+		localPod.SetAnnotations(annotations)
+	}
+
+	localPod.SetResourceVersion(pod.GetResourceVersion())
+
+	/*---------------------------------------------------
+	 * Merge the Mutable Fields of the Spec
+	 *---------------------------------------------------*/
+	localPod.Spec.ActiveDeadlineSeconds = pod.Spec.ActiveDeadlineSeconds
+	localPod.Spec.Tolerations = pod.Spec.Tolerations
+
+	rejectImageUpdates(pod, localPod.Spec.InitContainers, pod.Spec.InitContainers)
+	rejectImageUpdates(pod, localPod.Spec.Containers, pod.Spec.Containers)
+
+	/*---------------------------------------------------
+	 * Refresh the DownwardAPI Volumes
+	 *---------------------------------------------------*/
+	if !equality.Semantic.DeepEqual(oldPod.GetLabels(), localPod.GetLabels()) ||
+		!equality.Semantic.DeepEqual(oldPod.GetAnnotations(), localPod.GetAnnotations()) {
+		for _, vol := range localPod.Spec.Volumes {
+			if err := h.refreshDownwardAPIVolume(ctx, vol); err != nil {
+				return false, errors.Wrapf(err, "failed to refresh volume '%s'", vol.Name)
+			}
+		}
+
+		logger.Info(" * DownwardAPI volumes are refreshed")
+	}
+
+	/*---------------------------------------------------
+	 * Update the Slurm Job
+	 *---------------------------------------------------*/
+	statusChanged := false
+
+	if slurm.HasJobID(localPod) {
+		jobID := slurm.GetJobID(localPod)
+
+		updateSlurmJob(pod, jobID, oldPod.GetAnnotations(), localPod.GetAnnotations())
+
+		if hold := isHeld(localPod.GetAnnotations()); hold != isHeld(oldPod.GetAnnotations()) {
+			statusChanged = holdSlurmJob(pod, localPod, jobID, hold)
+		}
+	}
+
+	return statusChanged, SavePodToFile(ctx, localPod)
+}
+
+// rejectedImages holds the remote images that have been rejected, by pod and container name, so that every
+// image update is reported once, rather than on every update of the pod (e.g, on label changes).
+var rejectedImages sync.Map // client.ObjectKey -> map[string]string
+
+// forgetRejectedImages drops the rejected images of a deleted pod.
+func forgetRejectedImages(podKey client.ObjectKey) {
+	rejectedImages.Delete(podKey)
+}
+
+// rejectImageUpdates keeps the images of the local containers, and raises an event for every container
+// whose image is changed. The pod is not restarted, as the image is already part of the submitted job.
+func rejectImageUpdates(pod *corev1.Pod, local []corev1.Container, remote []corev1.Container) {
+	podKey := client.ObjectKeyFromObject(pod)
+
+	images := make(map[string]string, len(remote))
+	for _, container := range remote {
+		images[container.Name] = container.Image
+	}
+
+	seen, _ := rejectedImages.LoadOrStore(podKey, &sync.Map{})
+
+	for _, container := range local {
+		image, exists := images[container.Name]
+		if !exists || image == container.Image {
+			seen.(*sync.Map).Delete(container.Name)
+
+			continue
+		}
+
+		if previous, reported := seen.(*sync.Map).Load(container.Name); reported && previous == image {
+			continue
+		}
+
+		seen.(*sync.Map).Store(container.Name, image)
+
+		compute.EventRecorder.Eventf(pod, corev1.EventTypeWarning, "ImageUpdateRejected",
+			"Cannot update image of container '%s' from '%s' to '%s'. Recreate the pod instead.",
+			container.Name, container.Image, image)
+	}
+}
+
+// refreshDownwardAPIVolume rewrites the volumes that project the pod metadata.
+func (h *podHandler) refreshDownwardAPIVolume(ctx context.Context, vol corev1.Volume) error {
+	volDir := filepath.Join(h.podDirectory.VolumeDir(), vol.Name)
+
+	switch {
+	case vol.VolumeSource.DownwardAPI != nil:
+		h.DownwardAPIVolumeSource(ctx, vol)
+
+		return nil
+
+	case vol.VolumeSource.Projected != nil:
+		hasDownwardAPI := false
+
+		for _, source := range vol.VolumeSource.Projected.Sources {
+			if source.DownwardAPI != nil {
+				hasDownwardAPI = true
+			}
+		}
+
+		if !hasDownwardAPI {
+			return nil
+		}
+
+		if err := os.MkdirAll(volDir, endpoint.PodGlobalDirectoryPermissions); err != nil {
+			compute.SystemPanic(err, "cannot create dir '%s'", volDir)
+		}
+
+		mounter := projected.VolumeMounter{
+			Volume: vol,
+			Pod:    *h.Pod,
+			Logger: h.logger,
+		}
+
+		return mounter.SetUpAt(ctx, volDir)
+
+	default:
+		return nil
+	}
+}
+
+// updateSlurmJob applies the changed Slurm annotations to the job. Because Slurm permits most of the changes
+// only on pending jobs, failures are reported as events instead of failing the pod.
+func updateSlurmJob(pod *corev1.Pod, jobID string, oldAnnotations, newAnnotations map[string]string) {
+	logger := compute.DefaultLogger.WithValues("pod", client.ObjectKeyFromObject(pod), "jobID", jobID)
+
+	for _, mapping := range slurmJobAnnotations {
+		value := newAnnotations[mapping.Annotation]
+
+		if value == "" || value == oldAnnotations[mapping.Annotation] {
+			continue
+		}
+
+		out, err := slurm.UpdateJob(jobID, mapping.JobField+"="+value)
+		if err != nil {
+			logger.Info(" * Slurm job update has failed", "field", mapping.JobField, "value", value, "out", out, "err", err)
+
+			compute.EventRecorder.Eventf(pod, corev1.EventTypeWarning, "SlurmJobUpdateFailed",
+				"Cannot set %s=%s on job '%s': %v", mapping.JobField, value, jobID, err)
+
+			continue
+		}
+
+		logger.Info(" * Slurm job is updated", "field", mapping.JobField, "value", value)
+
+		compute.EventRecorder.Eventf(pod, corev1.EventTypeNormal, "SlurmJobUpdated",
+			"Set %s=%s on job '%s'", mapping.JobField, value, jobID)
+	}
+}
+
+// isHeld returns true if the pod requests its job to be held (or suspended).
+func isHeld(annotations map[string]string) bool {
+	hold, err := strconv.ParseBool(annotations[SlurmHold])
+
+	return err == nil && hold
+}
+
+// holdSlurmJob holds a pending job or suspends a running job, and vice versa for releasing.
+// It returns true if the PodSuspended condition of the local pod has changed.
+func holdSlurmJob(pod *corev1.Pod, localPod *corev1.Pod, jobID string, hold bool) bool {
+	logger := compute.DefaultLogger.WithValues("pod", client.ObjectKeyFromObject(pod), "jobID", jobID)
+
+	state, err := slurm.JobState(jobID)
+	if err != nil {
+		compute.EventRecorder.Eventf(pod, corev1.EventTypeWarning, "SlurmJobHoldFailed",
+			"Cannot get the state of job '%s': %v", jobID, err)
+
+		return false
+	}
+
+	type action struct {
+		run     func(jobID string) (string, error)
+		reason  string
+		message string
+	}
+
+	var act action
+
+	switch {
+	case hold && state == slurm.JobStatePending:
+		act = action{run: slurm.HoldJob, reason: "Held", message: "the job is held in the Slurm queue"}
+	case hold && state == slurm.JobStateRunning:
+		act = action{run: slurm.SuspendJob, reason: "Suspended", message: "the job is suspended by Slurm"}
+	case !hold && state == slurm.JobStatePending:
+		act = action{run: slurm.ReleaseJob, reason: "Released", message: "the job is released to the Slurm queue"}
+	case !hold && state == slurm.JobStateSuspended:
+		act = action{run: slurm.ResumeJob, reason: "Resumed", message: "the job is resumed by Slurm"}
+	default:
+		compute.EventRecorder.Eventf(pod, corev1.EventTypeWarning, "SlurmJobHoldFailed",
+			"Cannot change hold=%t on job '%s' in state '%s'", hold, jobID, state)
+
+		return false
+	}
+
+	out, err := act.run(jobID)
+	if err != nil {
+		logger.Info(" * Slurm job hold has failed", "hold", hold, "state", state, "out", out, "err", err)
+
+		compute.EventRecorder.Eventf(pod, corev1.EventTypeWarning, "SlurmJobHoldFailed",
+			"Cannot change hold=%t on job '%s': %v", hold, jobID, err)
+
+		return false
+	}
+
+	logger.Info(" * Slurm job hold has changed", "hold", hold, "state", state)
+
+	compute.EventRecorder.Event(pod, corev1.EventTypeNormal, act.reason, act.message)
+
+	setSuspendedCondition(localPod, hold, act.reason, act.message)
+
+	return true
+}
+
+func setSuspendedCondition(pod *corev1.Pod, suspended bool, reason string, message string) {
+	status := corev1.ConditionFalse
+	if suspended {
+		status = corev1.ConditionTrue
+	}
+
+	crdtools.SetPodStatusCondition(&pod.Status.Conditions, corev1.PodCondition{
+		Type:               PodSuspended,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	})
+}
@@ -0,0 +1,76 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podhandler
+
+import (
+	"context"
+
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/image"
+	corev1 "k8s.io/api/core/v1"
+	k8errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+/*
+resolvePullSecrets collects the registry credentials of the pod, from its imagePullSecrets and from the
+imagePullSecrets of its service account, in that order of precedence.
+As the kubelet, secrets that cannot be retrieved are reported with an Event, and the pull is attempted without them.
+The credentials are kept only in memory.
+*/
+func (h *podHandler) resolvePullSecrets(ctx context.Context) image.Keyring {
+	secretRefs := append([]corev1.LocalObjectReference{}, h.Pod.Spec.ImagePullSecrets...)
+
+	if saName := h.Pod.Spec.ServiceAccountName; saName != "" {
+		var sa corev1.ServiceAccount
+
+		key := types.NamespacedName{Namespace: h.Pod.GetNamespace(), Name: saName}
+
+		if err := compute.K8SClient.Get(ctx, key, &sa); err != nil {
+			if !k8errors.IsNotFound(err) {
+				h.logger.Error(err, "failed to get the service account for image pull secrets", "serviceAccount", saName)
+			}
+		} else {
+			secretRefs = append(secretRefs, sa.ImagePullSecrets...)
+		}
+	}
+
+	var keyring image.Keyring
+
+	for _, ref := range secretRefs {
+		var secret corev1.Secret
+
+		key := types.NamespacedName{Namespace: h.Pod.GetNamespace(), Name: ref.Name}
+
+		if err := compute.K8SClient.Get(ctx, key, &secret); err != nil {
+			compute.EventRecorder.Eventf(h.Pod, corev1.EventTypeWarning, compute.EventFailedToRetrieveImagePullSecret,
+				"Unable to retrieve some image pull secrets (%s); attempting to pull the image may not succeed.", ref.Name)
+
+			continue
+		}
+
+		secretKeyring, err := image.KeyringFromSecret(&secret)
+		if err != nil {
+			compute.EventRecorder.Eventf(h.Pod, corev1.EventTypeWarning, compute.EventFailedToRetrieveImagePullSecret,
+				"Invalid image pull secret (%s): %s", ref.Name, err)
+
+			continue
+		}
+
+		keyring = keyring.Merge(secretKeyring)
+	}
+
+	return keyring
+}
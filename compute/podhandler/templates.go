@@ -68,6 +68,47 @@ func strval(v interface{}) string {
 	}
 }
 
+// LogRotateTemplate provides the bash function that writes the logs of the job, and rotates them
+// according to the limits of the host environment. It is shared by the pod and the host scripts.
+const LogRotateTemplate = `
+# Appends the input lines to a log file, and rotates the file when it exceeds the maximum size
+# (e.g, main.logs -> main.logs.1 -> main.logs.2). Up to maxFiles files are kept, including the current one.
+# The lines are written by a single awk process, which forks only to rotate the files.
+function log_rotate() {
+	local logsPath=$1
+	local maxSize={{.HostEnv.ContainerLogMaxSize}}
+	local maxFiles={{.HostEnv.ContainerLogMaxFiles}}
+
+	if [[ ${maxSize} -le 0 ]]; then
+		cat >> ${logsPath}
+		return
+	fi
+
+	LC_ALL=C awk -v path=${logsPath} -v maxSize=${maxSize} -v maxFiles=${maxFiles} \
+		-v size=$(stat -c %s ${logsPath} 2>/dev/null || echo 0) '
+	function rotate(   i, cmd) {
+		close(path)
+
+		for (i = maxFiles - 1; i > 1; i--) {
+			cmd = cmd "[ ! -f " path "." (i - 1) " ] || mv -f " path "." (i - 1) " " path "." i "; "
+		}
+
+		system(cmd (maxFiles > 1 ? "mv -f " path " " path ".1" : "rm -f " path))
+		size = 0
+	}
+
+	{
+		if (size > 0 && size + length($0) + 1 > maxSize) {
+			rotate()
+		}
+
+		print >> path
+		fflush(path)
+		size += length($0) + 1
+	}'
+}
+`
+
 /*
 	PauseScriptTemplate provides the template for building pods.
 
@@ -139,6 +180,190 @@ function reset_env() {
 	unset SINGULARITY_BIND
 }
 
+# Prints the number of processes killed by the OOM killer within the cgroup of the job.
+# Both cgroup v1 (memory.oom_control) and cgroup v2 (memory.events) are supported.
+function oom_kill_count() {
+	local cgroupV1=$(grep -m 1 ':memory:' /proc/self/cgroup | cut -d: -f3)
+	local cgroupV2=$(grep -m 1 '^0::' /proc/self/cgroup | cut -d: -f3)
+	local events=/dev/null
+
+	if [[ -n "${cgroupV1}" && -f /sys/fs/cgroup/memory${cgroupV1}/memory.oom_control ]]; then
+		events=/sys/fs/cgroup/memory${cgroupV1}/memory.oom_control
+	elif [[ -f /sys/fs/cgroup${cgroupV2}/memory.events ]]; then
+		events=/sys/fs/cgroup${cgroupV2}/memory.events
+	fi
+
+	awk '/^oom_kill / {count=$2} END {print count+0}' ${events}
+}
+
+# Marks a container killed by SIGKILL as OOMKilled, if the OOM killer has been invoked since the container started.
+# The counter is shared by the containers of the job. Containers that fail otherwise are not marked, but a container
+# that is killed by SIGKILL while another one is OOM-killed cannot be told apart.
+function mark_oom_kill() {
+	local oomBefore=$1
+	local exitCode=$2
+	local oomKilledPath=$3
+
+	if [[ ${exitCode} -eq 137 && $(oom_kill_count) -gt ${oomBefore} ]]; then
+		echo "OOMKilled" > ${oomKilledPath}
+	fi
+}
+
+# Prints the resource usage of the cgroup of the job: "<cpu usage in ns> <memory working set in bytes>".
+# Both cgroup v1 (cpuacct, memory) and cgroup v2 (cpu.stat, memory.current) are supported.
+function cgroup_usage() {
+	local cpuV1=$(grep -m 1 -E '^[0-9]+:[^:]*cpuacct[^:]*:' /proc/self/cgroup | cut -d: -f2,3 | sed 's|:/|/|')
+	local memV1=$(grep -m 1 ':memory:' /proc/self/cgroup | cut -d: -f3)
+	local cgroupV2=$(grep -m 1 '^0::' /proc/self/cgroup | cut -d: -f3)
+	local cpu usage inactive
+
+	if [[ -n "${memV1}" && -f /sys/fs/cgroup/memory${memV1}/memory.usage_in_bytes ]]; then
+		cpu=$(cat /sys/fs/cgroup/${cpuV1}/cpuacct.usage 2>/dev/null)
+		usage=$(cat /sys/fs/cgroup/memory${memV1}/memory.usage_in_bytes)
+		inactive=$(awk '/^total_inactive_file / {print $2}' /sys/fs/cgroup/memory${memV1}/memory.stat)
+	elif [[ -f /sys/fs/cgroup${cgroupV2}/memory.current ]]; then
+		cpu=$(awk '/^usage_usec / {printf "%.0f", $2 * 1000}' /sys/fs/cgroup${cgroupV2}/cpu.stat)
+		usage=$(cat /sys/fs/cgroup${cgroupV2}/memory.current)
+		inactive=$(awk '/^inactive_file / {print $2}' /sys/fs/cgroup${cgroupV2}/memory.stat)
+	else
+		return 1
+	fi
+
+	# The working set excludes the page cache that can be reclaimed, as in the kubelet.
+	inactive=${inactive:-0}
+	echo "${cpu:--} $(( usage > inactive ? usage - inactive : 0 ))"
+}
+
+# Prints the resource usage of a process and its descendants: "<cpu usage in ns> <memory rss in bytes>".
+function process_tree_usage() {
+	local root=$1
+
+	# The command of a process (2nd field of /proc/<pid>/stat) is in parentheses, and it may contain spaces.
+	cat /proc/[0-9]*/stat 2>/dev/null | awk -v root=${root} -v hz=$(getconf CLK_TCK) -v page=$(getconf PAGESIZE) '
+		{ pid = $1; sub(/^.*\) /, ""); parent[pid] = $2; cpu[pid] = $12 + $13; rss[pid] = $22 }
+		END {
+			for (pid in parent) {
+				for (p = pid; (p in parent) && p != root; p = parent[p]) {}
+				if (p == root) { totalCPU += cpu[pid]; totalRSS += rss[pid] }
+			}
+			printf "%.0f %.0f\n", totalCPU * 1e9 / hz, totalRSS * page
+		}'
+}
+
+# Prints the network usage of the node, excluding the loopback: "<rx bytes> <rx errors> <tx bytes> <tx errors>".
+# Pods run on the network of the node (--network=host), and therefore they share its interfaces.
+function network_usage() {
+	awk 'NR > 2 { sub(/:/, " "); if ($1 != "lo") { rx += $2; rxErrors += $4; tx += $10; txErrors += $12 } }
+		END { printf "%.0f %.0f %.0f %.0f\n", rx, rxErrors, tx, txErrors }' /proc/net/dev
+}
+
+# Keeps the previous and the latest sample in the file, so that HPK can compute the rate of CPU usage.
+# The file is replaced atomically, as it is read concurrently by HPK.
+function record_sample() {
+	local path=$1
+	local sample=$2
+
+	{ tail -n 1 ${path} 2>/dev/null; echo "${sample}"; } > ${path}.tmp && mv ${path}.tmp ${path}
+}
+
+# Samples the resource usage of the pod and its containers, until the Virtual Environment exits.
+# Every sample is a line "<unix time in ns> <cpu usage in ns> <memory in bytes>", followed by the network usage for the pod.
+# Unavailable values are written as "-".
+function sample_stats() {
+	local virtualEnv=$1
+	local usage
+	declare -A containerPids
+
+	while kill -0 ${virtualEnv} 2>/dev/null; do
+		usage=$(cgroup_usage) || usage="- -"
+		record_sample {{.VirtualEnv.StatsPath}} "$(date +%s%N) ${usage} $(network_usage)"
+		{{- range $container := .Containers}}
+
+		# The main process of the container is known once the container is created.
+		if [[ ${containerPids[{{$container.InstanceName}}]:-0} -eq 0 ]]; then
+			containerPids[{{$container.InstanceName}}]=$(podman-hpc inspect --format '{{"{{.State.Pid}}"}}' {{$container.InstanceName}} 2>/dev/null)
+		fi
+
+		if [[ ${containerPids[{{$container.InstanceName}}]:-0} -gt 0 && ! -f {{$container.ExitCodePath}} ]]; then
+			record_sample {{$container.StatsPath}} "$(date +%s%N) $(process_tree_usage ${containerPids[{{$container.InstanceName}}]})"
+		fi
+		{{- end}}
+
+		sleep 10
+	done
+}
+
+# Writes the input lines in the CRI log format: "<timestamp> <stream> <F|P> <message>".
+# The timestamp is in RFC3339Nano (UTC), as expected by the log readers of HPK.
+# The lines are written by a single perl process, if perl is available. Otherwise, and in the interactive mode,
+# where input that is not terminated by a newline (e.g, a prompt) is written as a partial line, they are written by bash.
+function log_stream() {
+	local stream=$1
+	local readTimeout=""
+	local line tag code now nanos
+
+	if [[ "${2:-}" == "interactive" ]]; then
+		readTimeout=0.1
+	elif command -v perl > /dev/null; then
+		STREAM=${stream} perl -MPOSIX=strftime -MTime::HiRes=gettimeofday -ne '
+			BEGIN { $| = 1 }
+			chomp;
+			my ($s, $us) = gettimeofday();
+			printf "%s.%06d000Z %s F %s\n", strftime("%Y-%m-%dT%H:%M:%S", gmtime($s)), $us, $ENV{STREAM}, $_;'
+		return
+	fi
+
+	while true; do
+		IFS= read -r ${readTimeout:+-t ${readTimeout}} line && code=0 || code=$?
+
+		# a timed-out read keeps the input that has been read so far.
+		tag=F
+		if [[ ${code} -gt 128 ]]; then
+			tag=P
+		fi
+
+		if [[ -n "${line}" || ${code} -eq 0 ]]; then
+			now=${EPOCHREALTIME:-$(date +%s.%N)}
+			now=${now/,/.}
+			nanos="${now#*.}000000000"
+			TZ=UTC printf '%(%Y-%m-%dT%H:%M:%S)T.%sZ %s %s %s\n' "${now%.*}" "${nanos:0:9}" "${stream}" "${tag}" "${line}"
+		fi
+
+		# the input has ended.
+		if [[ ${code} -ne 0 && ${code} -le 128 ]]; then
+			break
+		fi
+	done
+}
+` + LogRotateTemplate + `
+# Runs a command, and writes its stdout and stderr as distinct streams of the same CRI log file.
+# Both streams go through a single writer, which rotates the log file.
+# It returns once all the lines are written, with the exit code of the command.
+function run_logged() {
+	local logsPath=$1
+	shift
+
+	{
+		{ "$@" 2>&3 3>&- 4>&- | log_stream stdout >&4; exit ${PIPESTATUS[0]}; } 3>&1 | log_stream stderr; exit ${PIPESTATUS[0]};
+	} 4>&1 | log_rotate ${logsPath}
+
+	return ${PIPESTATUS[0]}
+}
+
+# Runs an interactive command within a pseudo-terminal, whose input is the stdin of the function.
+# The output is written in the CRI log format, where the terminal merges stderr into stdout.
+# The path of the pseudo-terminal is written to ttyPath, so that HPK can resize the terminal.
+function run_logged_tty() {
+	local logsPath=$1
+	local ttyPath=$2
+	shift 2
+
+	SHELL=/bin/bash script --quiet --flush --return --command "tty > $(printf '%q' ${ttyPath}); exec $(printf '%q ' "$@")" /dev/null \
+		| log_stream stdout interactive | log_rotate ${logsPath}
+
+	return ${PIPESTATUS[0]}
+}
+
 function cleanup() {
 	lastCommand=$1
 	exitCode=$2
@@ -154,6 +379,28 @@ function cleanup() {
 
 	exit ${exitCode}
 }
+{{- if .CheckpointCommand}}
+
+# Handles the termination warning of Slurm (e.g, preemption, or time limit).
+# The checkpoint command runs within the checkpoint container, and it must complete before the job is killed.
+function checkpoint() {
+	echo "[Virtual] Termination warning has been received. Checkpointing ..."
+	date > {{.VirtualEnv.PreemptedPath}}
+
+	checkpointCode=0
+	podman-hpc exec {{.CheckpointContainer}} sh -c {{.CheckpointCommand | param}} || checkpointCode=$?
+
+	echo "[Virtual] Checkpoint has completed with code ${checkpointCode}. Terminating containers ..."
+	for pid in $(jobs -p); do
+		kill -TERM -- -${pid} 2>/dev/null || true
+	done
+	wait || true
+
+	# Mark the completion of the checkpoint, so that HPK resubmits the job.
+	echo ${checkpointCode} > {{.VirtualEnv.CheckpointPath}}
+	exit 0
+}
+{{- end}}
 
 function handle_init_containers() {
 {{range $index, $container := .InitContainers}}
@@ -170,8 +417,9 @@ function handle_init_containers() {
 	# Mark the beginning of an init job (all get the shell's pid).  
 	echo pid://$$ > {{$container.JobIDPath}}
 
+	oom_before=$(oom_kill_count)
 
-	$(apptainer {{ $container.ExecutionMode }} --cleanenv --writable-tmpfs --no-mount home --unsquash \
+	$(run_logged {{$container.LogsPath}} apptainer {{ $container.ExecutionMode }} --cleanenv --writable-tmpfs --no-mount home --unsquash \
 	{{- if $container.RunAsUser}}
 	--security uid:{{$container.RunAsUser}},gid:{{$container.RunAsUser}} --userns \
 	{{- end}}
@@ -189,10 +437,12 @@ function handle_init_containers() {
 	{{- if $container.Args}}
 		{{range $index, $arg := $container.Args}} {{$arg | param}} {{- end}}
 	{{- end }} \
-	&>> {{$container.LogsPath}})
+	)
 
 	# Mark the ending of an init job.
-	echo $? > {{$container.ExitCodePath}}
+	exitCode=$?
+	mark_oom_kill ${oom_before} ${exitCode} {{$container.OOMKilledPath}}
+	echo ${exitCode} > {{$container.ExitCodePath}}
 {{end}}
 
 	echo "[Virtual] All InitContainers have been completed."
@@ -209,7 +459,27 @@ function handle_containers() {
 	sh -c {{$container.EnvFilePath}} > /tmp/scratch/{{$container.InstanceName}}.env
 	{{- end}}
 
-	$(podman-hpc run --rm --gpu --network=host --no-hosts --workdir ${workdir} \
+	{{- if $container.StdinPath}}
+
+	# The stdin of the container is written by 'kubectl attach'.
+	rm -f {{$container.StdinPath}} && mkfifo {{$container.StdinPath}}
+	{{- end}}
+
+	oom_before=$(oom_kill_count)
+
+	$(
+	{{- if $container.TTYPath -}}
+	run_logged_tty {{$container.LogsPath}} {{$container.TTYPath}}
+	{{- else -}}
+	run_logged {{$container.LogsPath}}
+	{{- end}} podman-hpc run --rm --gpu --network=host --no-hosts --workdir ${workdir} \
+	--name {{$container.InstanceName}} --replace \
+	{{- if $container.StdinPath}}
+	--interactive \
+	{{- end}}
+	{{- if $container.TTYPath}}
+	--tty \
+	{{- end}}
 	-e PARENT=${PPID} \
 	-e MODEL_NAME=resnet \
 	-v $HOME/.k8sfs/kubernetes:/k8s-data \
@@ -240,8 +510,13 @@ function handle_containers() {
 	{{- if $container.Args}}
 		{{- range $index, $arg := $container.Args}} {{$arg | param}} {{- end}}
 	{{- end }} \
-	&>> {{$container.LogsPath}}; \
-	echo $? > {{$container.ExitCodePath}}) &
+	{{- if $container.StdinPath}}
+	<> {{$container.StdinPath}} \
+	{{- end}}
+	; \
+	exitCode=$?; \
+	mark_oom_kill ${oom_before} ${exitCode} {{$container.OOMKilledPath}}; \
+	echo ${exitCode} > {{$container.ExitCodePath}}) &
 	pid=$!
 	echo pid://${pid} > {{$container.JobIDPath}}
 	echo "[Virtual] Container started: {{$container.InstanceName}} ${pid}"
@@ -264,13 +539,22 @@ echo "[Virtual] Resetting Environment ..."
 reset_env
 
 echo "[Virtual] Announcing IP ..."
+hostname > {{.VirtualEnv.HostnamePath}}
 echo $(hostname -I | tr ' ' '\n' | grep '^128' | head -n 1) > {{.VirtualEnv.IPAddressPath}}
 
 echo "[Virtual] Setting DNS ..."
 handle_dns
 
+echo "[Virtual] Sampling Resource Usage ..."
+( sample_stats $$ & )
+
 echo "[Virtual] Setting Cleanup Handler ..."
 trap 'cleanup "${BASH_COMMAND}" "$?"'  EXIT
+{{- if .CheckpointCommand}}
+
+echo "[Virtual] Setting Checkpoint Handler ..."
+trap checkpoint TERM
+{{- end}}
 
 {{if gt (len .InitContainers) 0 }} handle_init_containers {{end}}
 
@@ -288,6 +572,10 @@ const HostScriptTemplate = `#!/bin/bash
                             # to send SIGTERM to the job 60 secs
                             # before its time ends to give it a
                             # chance for better cleanup.
+{{- if .CheckpointCommand}}
+#SBATCH --no-requeue        # HPK resubmits the job after the checkpoint.
+#SBATCH --open-mode=append
+{{- end}}
 
 {{- if .ResourceRequest.CPU}}
 #SBATCH --ntasks-per-node={{.ResourceRequest.CPU}}
@@ -314,6 +602,20 @@ PAUSE_EOF
 # exit when any command fails
 #set -um pipeline
 set -u
+{{- if .HostEnv.ContainerLogMaxSize}}
+` + LogRotateTemplate + `
+# Slurm does not limit the output of the job, which is therefore rotated as the logs of the containers.
+exec > >(log_rotate {{.VirtualEnv.StdoutPath}})
+stdoutWriter=$!
+exec 2> >(log_rotate {{.VirtualEnv.StderrPath}})
+stderrWriter=$!
+
+# Waits for the output to be written, before Slurm terminates the job.
+function flush_output() {
+	exec 1>&- 2>&-
+	wait ${stdoutWriter} ${stderrWriter} 2>/dev/null || true
+}
+{{- end}}
 
 echo "[Host] Starting the Constructor for the Virtual Environment ..."
 chmod +x  {{.VirtualEnv.ConstructorFilePath}}
@@ -321,12 +623,38 @@ chmod +x  {{.VirtualEnv.ConstructorFilePath}}
 export workdir=/tmp/{{.Pod.Namespace}}_{{.Pod.Name}}
 echo "[Host] Creating workdir: ${workdir} "
 mkdir -p ${workdir}
-trap 'echo [HOST] Deleting workdir ${workdir}; rm -rf ${workdir}' EXIT
+trap 'echo [HOST] Deleting workdir ${workdir}; rm -rf ${workdir} {{- if .HostEnv.ContainerLogMaxSize}}; flush_output{{end}}' EXIT
 
 export APPTAINERENV_KUBEDNS_IP={{.HostEnv.KubeDNS}}
 
+{{- if or .CheckpointCommand .HostEnv.ContainerLogMaxSize}}
+# The batch shell must outlive the Virtual Environment, in order to complete the checkpoint or flush the output.
+{{.VirtualEnv.ConstructorFilePath}} &
+constructor=$!
+
+{{- if .CheckpointCommand}}
+# The termination warning is sent only to the batch shell, and must be forwarded to the Virtual Environment.
+trap 'kill -TERM ${constructor} 2>/dev/null' TERM
+{{- else}}
+# Without a checkpoint, the termination warning is ignored, and the output is flushed when the job exits.
+trap '' TERM
+{{- end}}
+
+# wait is interrupted by trapped signals, and must be repeated until the constructor exits.
+while true; do
+	wait ${constructor} && exitCode=0 || exitCode=$?
+	kill -0 ${constructor} 2>/dev/null || break
+done
+
+if [[ ${exitCode} -ne 0 ]]; then
+	echo "[HOST] **SYSTEMERROR** apptainer exited with code ${exitCode}" | tee {{.VirtualEnv.SysErrorFilePath}}
+fi
+
+exit ${exitCode}
+{{- else}}
 exec sh -ci {{.VirtualEnv.ConstructorFilePath}} ||
 echo "[HOST] **SYSTEMERROR** apptainer exited with code $?" | tee {{.VirtualEnv.SysErrorFilePath}}
+{{- end}}
 
 #### END SECTION: Host Environment ####
 `
@@ -351,6 +679,13 @@ type JobFields struct {
 
 	// CustomFlags are flags given by the user via 'slurm.hpk.io/flags' annotations
 	CustomFlags []string
+
+	// CheckpointCommand is given by the user via 'slurm.hpk.io/checkpoint-command' annotation,
+	// and it is invoked upon the termination warning of Slurm.
+	CheckpointCommand string
+
+	// CheckpointContainer is the instance of the container wherein the CheckpointCommand is executed.
+	CheckpointContainer string
 }
 
 // The Container creates new within the Pod and resemble the "Container" semantics.
@@ -368,7 +703,7 @@ type Container struct {
 	// PodSecurityContext, the value specified in SecurityContext takes precedence.
 	RunAsGroup int64
 
-	ImageName string // format: REGISTRY://image:tag
+	ImageName string // format: registry/repository:tag, after the rewrite rules
 
 	EnvFilePath string
 
@@ -389,6 +724,19 @@ type Container struct {
 
 	// ExitCodePath is the path where the embedded Container command will write its exit code
 	ExitCodePath string
+
+	// OOMKilledPath is the path where the job marks that the container has been killed by the OOM killer.
+	OOMKilledPath string
+
+	// StatsPath is the path where the job writes the samples of resource usage of the container.
+	StatsPath string
+
+	// StdinPath is the FIFO that is bound to the stdin of an interactive container. Empty if stdin is not requested.
+	StdinPath string
+
+	// TTYPath is the file where the job writes the pseudo-terminal of an interactive container.
+	// Empty if a terminal is not requested.
+	TTYPath string
 }
 
 // GenerateEnvTemplate is used to generate environment variables.
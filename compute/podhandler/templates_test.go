@@ -128,6 +128,7 @@ func TestConstructorSyntax(t *testing.T) {
 					CgroupFilePath:      podDir.CgroupFilePath(),
 					ConstructorFilePath: podDir.ConstructorFilePath(),
 					IPAddressPath:       podDir.IPAddressPath(),
+					HostnamePath:        podDir.HostnamePath(),
 					StdoutPath:          podDir.StdoutPath(),
 					StderrPath:          podDir.StderrPath(),
 					SysErrorFilePath:    "",
@@ -137,7 +138,7 @@ func TestConstructorSyntax(t *testing.T) {
 						InstanceName:  "init0",
 						RunAsUser:     0,
 						RunAsGroup:    0,
-						ImageFilePath: "/image/path",
+						ImageName:     "/image/path",
 						EnvFilePath:   "/env/path",
 						Binds:         nil,
 						Command:       []string{"ls"},
@@ -151,7 +152,7 @@ func TestConstructorSyntax(t *testing.T) {
 						InstanceName:  "init1",
 						RunAsUser:     0,
 						RunAsGroup:    0,
-						ImageFilePath: "/image/path",
+						ImageName:     "/image/path",
 						EnvFilePath:   "/env/path",
 						Binds:         nil,
 						Command:       []string{"touch"},
@@ -168,7 +169,7 @@ func TestConstructorSyntax(t *testing.T) {
 						InstanceName:  "lala",
 						RunAsUser:     0,
 						RunAsGroup:    0,
-						ImageFilePath: "/image/path",
+						ImageName:     "/image/path",
 						EnvFilePath:   "/env/path",
 						Binds:         nil,
 						Command: []string{`
@@ -189,7 +190,7 @@ func TestConstructorSyntax(t *testing.T) {
 						InstanceName:  "sidecar",
 						RunAsUser:     0,
 						RunAsGroup:    0,
-						ImageFilePath: "/image/path",
+						ImageName:     "/image/path",
 						EnvFilePath:   "/env/path",
 						Binds:         nil,
 						// Stupid unescaped args
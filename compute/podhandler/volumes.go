@@ -16,13 +16,13 @@ package podhandler
 
 import (
 	"context"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/carv-ics-forth/hpk/compute/endpoint"
 	"github.com/carv-ics-forth/hpk/compute/volume/configmap"
+	"github.com/carv-ics-forth/hpk/compute/volume/downwardapi"
 	"github.com/carv-ics-forth/hpk/compute/volume/emptydir"
 	"github.com/carv-ics-forth/hpk/compute/volume/hostpath"
 	"github.com/carv-ics-forth/hpk/compute/volume/projected"
@@ -32,8 +32,6 @@ import (
 	mounter "k8s.io/utils/mount"
 
 	"github.com/carv-ics-forth/hpk/compute"
-	"github.com/carv-ics-forth/hpk/pkg/fieldpath"
-	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	k8errors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
@@ -222,7 +220,7 @@ func (h *podHandler) mountVolumeSource(ctx context.Context, vol corev1.Volume) e
 		return nil
 
 	default:
-		logrus.Warn(vol)
+		h.logger.Info("Unsupported volume", "volume", vol)
 
 		panic("It seems I have missed a Volume type")
 	}
@@ -235,18 +233,14 @@ func (h *podHandler) DownwardAPIVolumeSource(ctx context.Context, vol corev1.Vol
 		compute.SystemPanic(err, "cannot create dir '%s'", downApiDir)
 	}
 
-	for _, item := range vol.DownwardAPI.Items {
-		itemPath := filepath.Join(downApiDir, item.Path)
-		value, err := fieldpath.ExtractFieldPathAsString(h.Pod, item.FieldRef.FieldPath)
-		if err != nil {
-			compute.PodError(h.Pod, compute.ReasonSpecError, err.Error())
-
-			return
-		}
+	mounter := downwardapi.VolumeMounter{
+		Volume: vol,
+		Pod:    *h.Pod,
+		Logger: h.logger,
+	}
 
-		if err := os.WriteFile(itemPath, []byte(value), fs.FileMode(*vol.Projected.DefaultMode)); err != nil {
-			compute.SystemPanic(err, "cannot write config map file '%s'", itemPath)
-		}
+	if err := mounter.SetUpAt(ctx, downApiDir); err != nil {
+		compute.PodError(h.Pod, compute.ReasonSpecError, "%v", err)
 	}
 }
 
@@ -343,7 +337,7 @@ func (h *podHandler) PersistentVolumeClaimSource(ctx context.Context, vol corev1
 
 		h.logger.Info("  * Local Volume is mounted", "name", vol.Name)
 	default:
-		logrus.Warn(vol)
+		h.logger.Info("Unsupported persistent volume", "volume", vol)
 
 		panic("It seems I have missed a PersistentVolume type")
 	}
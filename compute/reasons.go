@@ -0,0 +1,69 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+// Reasons of the Events that HPK emits for the lifecycle milestones of pods.
+// Users filter on them (e.g, kubectl get events --field-selector reason=JobSubmitted), so they must remain stable.
+// Where the kubelet emits an equivalent event, the reason of the kubelet is reused.
+const (
+	// EventVolumesMounted is emitted when all the volumes of the pod have been mounted.
+	EventVolumesMounted = "VolumesMounted"
+
+	// EventFailedMount is emitted when a volume of the pod cannot be mounted.
+	EventFailedMount = "FailedMount"
+
+	// EventPulling is emitted when the image of a container starts to be pulled.
+	EventPulling = "Pulling"
+
+	// EventPulled is emitted when the image of a container has been pulled.
+	EventPulled = "Pulled"
+
+	// EventFailedPull is emitted when the image of a container cannot be pulled.
+	// The kubelet reports every failure of a container with the same reason.
+	EventFailedPull = "Failed"
+
+	// EventBackOff is emitted when the pull of an image is retried after repeated failures.
+	EventBackOff = "BackOff"
+
+	// EventErrImageNeverPull is emitted when the image is not present, and the pull policy is Never.
+	EventErrImageNeverPull = "ErrImageNeverPull"
+
+	// EventInspectFailed is emitted when the name of the image is invalid.
+	EventInspectFailed = "InspectFailed"
+
+	// EventFailedToRetrieveImagePullSecret is emitted when an image pull secret of the pod cannot be used.
+	EventFailedToRetrieveImagePullSecret = "FailedToRetrieveImagePullSecret"
+
+	// EventJobSubmitted is emitted when the job of the pod has been submitted to Slurm.
+	EventJobSubmitted = "JobSubmitted"
+
+	// EventJobStarted is emitted when the job of the pod has left the Slurm queue.
+	EventJobStarted = "JobStarted"
+
+	// EventNodeAssigned is emitted when the compute node of the pod is known.
+	EventNodeAssigned = "NodeAssigned"
+
+	// EventStarted is emitted when a container has started.
+	EventStarted = "Started"
+
+	// EventExited is emitted when a container has exited.
+	EventExited = "Exited"
+
+	// EventSystemError is emitted when the job of the pod has failed before starting its containers.
+	EventSystemError = "SystemError"
+
+	// EventJobCancelled is emitted when the job of the pod has been cancelled.
+	EventJobCancelled = "JobCancelled"
+)
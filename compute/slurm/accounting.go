@@ -0,0 +1,54 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Job states as reported by Slurm.
+// https://slurm.schedmd.com/sacct.html#SECTION_JOB-STATE-CODES
+const (
+	JobStatePending   = "PENDING"
+	JobStateRunning   = "RUNNING"
+	JobStateSuspended = "SUSPENDED"
+
+	// JobStateOutOfMemory is reported when a job has been terminated for exceeding its memory limit.
+	JobStateOutOfMemory = "OUT_OF_MEMORY"
+)
+
+// JobState queries the Slurm accounting for the state of a job (e.g, COMPLETED, FAILED, OUT_OF_MEMORY).
+func JobState(jobID string) (string, error) {
+	out, err := execute(Slurm.AccountingCmd,
+		"--jobs", jobID,
+		"--allocations",
+		"--noheader",
+		"--parsable2",
+		"--format=State",
+	)
+	if err != nil {
+		return "", errors.Wrapf(err, "accounting query error. out : '%s'", out)
+	}
+
+	// the state may be followed by details, e.g, "CANCELLED by 1000".
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", errors.Errorf("no accounting info for job '%s'", jobID)
+	}
+
+	return fields[0], nil
+}
@@ -18,7 +18,7 @@ package slurm
 import (
 	"strings"
 
-	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/carv-ics-forth/hpk/compute/metrics"
 	"github.com/pkg/errors"
 )
 
@@ -43,7 +43,7 @@ func CancelJob(args string) (string, error) {
 	 Send SIGTERM using kill to the internal script's
 	 process and wait for it to close gracefully.
 	*/
-	out, err := process.Execute(Slurm.CancelCmd /*Signal, SignalChildren,*/, args)
+	out, err := execute(Slurm.CancelCmd /*Signal, SignalChildren,*/, args)
 	if err != nil {
 		outStr := string(out)
 
@@ -59,5 +59,7 @@ func CancelJob(args string) (string, error) {
 		return string(out), errors.Wrap(err, "Could not run scancel")
 	}
 
+	metrics.JobsCancelled.Inc()
+
 	return string(out), nil
 }
@@ -14,6 +14,13 @@
 
 package slurm
 
+import (
+	"time"
+
+	"github.com/carv-ics-forth/hpk/compute/metrics"
+	"github.com/carv-ics-forth/hpk/pkg/process"
+)
+
 /************************************************************
 
 			Initiate Slurm Connector
@@ -24,6 +31,9 @@ func init() {
 	Slurm.SubmitCmd = "sbatch"  // path.GetPathOrDie("sbatch")
 	Slurm.CancelCmd = "scancel" // path.GetPathOrDie("scancel")
 	Slurm.StatsCmd = "sinfo"
+	Slurm.AccountingCmd = "sacct"
+	Slurm.ControlCmd = "scontrol"
+	Slurm.RunCmd = "srun"
 }
 
 // Slurm represents a SLURM installation.
@@ -31,6 +41,10 @@ var Slurm struct {
 	SubmitCmd string
 	CancelCmd string
 	StatsCmd  string
+
+	AccountingCmd string
+	ControlCmd    string
+	RunCmd        string
 }
 
 // ConnectionOK return true if HPK maintains connection with the Slurm manager.
@@ -38,3 +52,14 @@ var Slurm struct {
 func ConnectionOK() bool {
 	return true
 }
+
+// execute runs a Slurm command and records its latency.
+func execute(command string, arguments ...string) ([]byte, error) {
+	start := time.Now()
+
+	out, err := process.Execute(command, arguments...)
+
+	metrics.ObserveSlurmCommand(command, start, err)
+
+	return out, err
+}
@@ -21,6 +21,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// JobIDAnnotation holds the typed ID of the job that runs the pod. It is set only on the local copy of the pod.
+const JobIDAnnotation = "pod.hpk/id"
+
 type JobIDType string
 
 const (
@@ -34,7 +37,7 @@ const (
 )
 
 func SetPodID(pod *corev1.Pod, idType JobIDType, value string) {
-	metav1.SetMetaDataAnnotation(&pod.ObjectMeta, "pod.hpk/id", string(idType)+value)
+	metav1.SetMetaDataAnnotation(&pod.ObjectMeta, JobIDAnnotation, string(idType)+value)
 }
 
 func SetContainerStatusID(status *corev1.ContainerStatus, typedValue string) {
@@ -45,13 +48,13 @@ func SetContainerStatusID(status *corev1.ContainerStatus, typedValue string) {
 }
 
 func HasJobID(pod *corev1.Pod) bool {
-	_, exists := pod.GetAnnotations()["pod.hpk/id"]
+	_, exists := pod.GetAnnotations()[JobIDAnnotation]
 
 	return exists
 }
 
 func GetJobID(pod *corev1.Pod) string {
-	raw, exists := pod.GetAnnotations()["pod.hpk/id"]
+	raw, exists := pod.GetAnnotations()[JobIDAnnotation]
 
 	if !exists {
 		panic("this should not happen")
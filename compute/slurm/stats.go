@@ -19,7 +19,6 @@ import (
 	"context"
 
 	"github.com/carv-ics-forth/hpk/compute"
-	"github.com/carv-ics-forth/hpk/pkg/process"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/json"
@@ -102,7 +101,7 @@ type Stats struct {
 }
 
 func getClusterStats() Stats {
-	out, err := process.Execute(Slurm.StatsCmd, "--long", "--json")
+	out, err := execute(Slurm.StatsCmd, "--long", "--json")
 	if err != nil {
 		compute.SystemPanic(err, "stats query error. out : '%s'", out)
 	}
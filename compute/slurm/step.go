@@ -0,0 +1,34 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"context"
+
+	"github.com/carv-ics-forth/hpk/pkg/process"
+)
+
+// RunInJob runs a command as a new step of a running job, on the node of the job.
+// The step shares the resources of the job, and its streams are forwarded to the caller.
+// https://slurm.schedmd.com/srun.html#OPT_overlap
+func RunInJob(ctx context.Context, jobID string, streams process.Streams, command ...string) error {
+	args := []string{"--jobid=" + jobID, "--overlap", "--nodes=1", "--ntasks=1", "--quiet"}
+
+	if streams.TTY {
+		args = append(args, "--pty")
+	}
+
+	return process.ExecuteWithStreams(ctx, streams, Slurm.RunCmd, append(args, command...)...)
+}
@@ -20,7 +20,7 @@ import (
 	"strconv"
 
 	"github.com/carv-ics-forth/hpk/compute"
-	"github.com/carv-ics-forth/hpk/pkg/process"
+	"github.com/carv-ics-forth/hpk/compute/metrics"
 )
 
 // ExcludeNodes EXISTS ONLY FOR DEBUGGING PURPOSES of Inotify on NFS.
@@ -35,7 +35,7 @@ var NewUserEnv = "--get-user-env=10L"
 func SubmitJob(scriptFile string) (string, error) {
 
 	// Submit Job
-	out, err := process.Execute(Slurm.SubmitCmd, ExcludeNodes, NewUserEnv, scriptFile)
+	out, err := execute(Slurm.SubmitCmd, ExcludeNodes, NewUserEnv, scriptFile)
 	if err != nil {
 		compute.SystemPanic(err, "job submission error. out : '%s'", out)
 	}
@@ -48,5 +48,7 @@ func SubmitJob(scriptFile string) (string, error) {
 		compute.SystemPanic(err, "Invalid JobID")
 	}
 
+	metrics.JobsSubmitted.Inc()
+
 	return jid[1], nil
 }
@@ -0,0 +1,86 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slurm
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrJobNotPending is returned when a job modification is only permitted on queued jobs.
+var ErrJobNotPending = errors.New("job is no longer pending")
+
+// UpdateJob modifies the attributes of a job. Every field is in the form of 'Key=Value', e.g., 'TimeLimit=10:00'.
+// https://slurm.schedmd.com/scontrol.html#OPT_update
+func UpdateJob(jobID string, fields ...string) (string, error) {
+	args := append([]string{"update", "JobId=" + jobID}, fields...)
+
+	out, err := execute(Slurm.ControlCmd, args...)
+	if err != nil {
+		outStr := string(out)
+
+		if strings.Contains(outStr, "Invalid job id specified") {
+			return outStr, ErrInvalidJob
+		}
+
+		if strings.Contains(outStr, "Job is no longer pending execution") {
+			return outStr, ErrJobNotPending
+		}
+
+		return outStr, errors.Wrap(err, "Could not run scontrol update")
+	}
+
+	return string(out), nil
+}
+
+// HoldJob prevents a pending job from being started.
+func HoldJob(jobID string) (string, error) {
+	return controlJob("hold", jobID)
+}
+
+// ReleaseJob releases a previously held job.
+func ReleaseJob(jobID string) (string, error) {
+	return controlJob("release", jobID)
+}
+
+// SuspendJob pauses a running job. Typically, it requires operator privileges on the Slurm cluster.
+func SuspendJob(jobID string) (string, error) {
+	return controlJob("suspend", jobID)
+}
+
+// ResumeJob resumes a previously suspended job.
+func ResumeJob(jobID string) (string, error) {
+	return controlJob("resume", jobID)
+}
+
+func controlJob(action string, jobID string) (string, error) {
+	out, err := execute(Slurm.ControlCmd, action, jobID)
+	if err != nil {
+		outStr := string(out)
+
+		if strings.Contains(outStr, "Invalid job id specified") {
+			return outStr, ErrInvalidJob
+		}
+
+		if strings.Contains(outStr, "Job is no longer pending execution") {
+			return outStr, ErrJobNotPending
+		}
+
+		return outStr, errors.Wrapf(err, "Could not run scontrol %s", action)
+	}
+
+	return string(out), nil
+}
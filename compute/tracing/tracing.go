@@ -0,0 +1,174 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing traces the lifecycle of pods with OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const instrumentationName = "github.com/carv-ics-forth/hpk"
+
+/*
+TraceContextAnnotation holds the context of the span that has created the pod, in the W3C format.
+Later events of the pod (e.g, from the Slurm job) start their own traces, which are linked to the creation trace.
+It is a local-only annotation, like the job ID, and therefore it never appears on the pods received from Kubernetes.
+*/
+const TraceContextAnnotation = "pod.hpk/trace-context"
+
+// AttributeJobID is the ID of the Slurm job of the pod. The rest of the attributes follow the semantic conventions.
+const AttributeJobID = attribute.Key("slurm.job.id")
+
+var propagator = propagation.TraceContext{}
+
+// tracesPath is the path where collectors receive traces.
+const tracesPath = "/v1/traces"
+
+/*
+Setup exports the spans to the OTLP/HTTP collector at endpoint (e.g, http://localhost:4318).
+The endpoint is either a base URL, in which case the traces path is appended, or a full URL that ends in the
+traces path. The rest of the exporter is configured by the OTEL_EXPORTER_OTLP_* variables (e.g, headers, timeout).
+If the endpoint is empty, tracing is disabled and spans are dropped.
+The returned function flushes the pending spans, and it must be called before exiting.
+*/
+func Setup(endpoint string, version string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	collector, err := url.Parse(endpoint)
+	if err != nil || (collector.Scheme != "http" && collector.Scheme != "https") || collector.Host == "" {
+		return nil, errors.Errorf("invalid endpoint '%s': expected http:// or https:// URL", endpoint)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(collector.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(strings.TrimSuffix(collector.Path, "/"), tracesPath) + tracesPath),
+	}
+
+	if collector.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the trace exporter")
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String("hpk-kubelet"),
+		semconv.ServiceVersionKey.String(version),
+	))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the trace resource")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of HPK.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// PodAttributes identify the pod in the spans.
+func PodAttributes(pod *corev1.Pod) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.K8SNamespaceNameKey.String(pod.GetNamespace()),
+		semconv.K8SPodNameKey.String(pod.GetName()),
+		semconv.K8SPodUIDKey.String(string(pod.GetUID())),
+	}
+}
+
+// SetPodTraceContext records the span of ctx in the annotations of the pod.
+func SetPodTraceContext(ctx context.Context, pod *corev1.Pod) {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+
+	traceParent, ok := carrier["traceparent"]
+	if !ok {
+		// tracing is disabled.
+		return
+	}
+
+	annotations := pod.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotations[TraceContextAnnotation] = traceParent
+	pod.SetAnnotations(annotations)
+}
+
+// PodTraceContext returns the span that has created the pod, if it has been recorded.
+func PodTraceContext(pod *corev1.Pod) (trace.SpanContext, bool) {
+	traceParent, ok := pod.GetAnnotations()[TraceContextAnnotation]
+	if !ok {
+		return trace.SpanContext{}, false
+	}
+
+	ctx := propagator.Extract(context.Background(), propagation.MapCarrier{"traceparent": traceParent})
+
+	spanContext := trace.SpanContextFromContext(ctx)
+
+	return spanContext, spanContext.IsValid()
+}
+
+// StartPodEventSpan starts a span for an event of the pod, which is linked to the trace that has created the pod.
+func StartPodEventSpan(ctx context.Context, pod *corev1.Pod, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithAttributes(PodAttributes(pod)...),
+		trace.WithAttributes(attrs...),
+	}
+
+	if creation, ok := PodTraceContext(pod); ok {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: creation}))
+	}
+
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// EndSpan ends the span, and marks it as failed if there is an error.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
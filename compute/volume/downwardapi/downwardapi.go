@@ -16,16 +16,55 @@
 package downwardapi
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 
 	volumeutil "github.com/carv-ics-forth/hpk/compute/volume/util"
 	"github.com/carv-ics-forth/hpk/pkg/fieldpath"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/klog/v2"
 )
 
+// VolumeMounter handles placing the pod metadata into the volume on the host.
+// Because the writer is atomic, SetUpAt can be called again to refresh the files when the pod metadata change.
+type VolumeMounter struct {
+	Volume corev1.Volume
+	Pod    corev1.Pod
+
+	Logger logr.Logger
+}
+
+func (b *VolumeMounter) SetUpAt(_ context.Context, dir string) error {
+	payload, err := CollectData(b.Volume.DownwardAPI.Items, &b.Pod, b.Volume.DownwardAPI.DefaultMode)
+	if err != nil {
+		return errors.Wrapf(err, "error preparing data for downwardAPI volume '%s'", b.Volume.Name)
+	}
+
+	/*---------------------------------------------------
+	 * Mount Resource to the host
+	 *---------------------------------------------------*/
+	if err := volumeutil.MakeNestedMountpoints(b.Volume.Name, dir, b.Pod); err != nil {
+		return err
+	}
+
+	writerContext := fmt.Sprintf("Pod %v/%v volume %v", b.Pod.Namespace, b.Pod.Name, b.Volume.Name)
+
+	writer, err := volumeutil.NewAtomicWriter(dir, writerContext)
+	if err != nil {
+		return errors.Wrapf(err, "Error creating atomic writer")
+	}
+
+	if err := writer.Write(payload); err != nil {
+		return errors.Wrapf(err, "Error writing payload to dir")
+	}
+
+	return nil
+}
+
 // CollectData collects requested downwardAPI in data map.
 // Map's key is the requested name of file to dump
 // Map's value is the (sorted) content of the field to be dumped in the file.
@@ -0,0 +1,258 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package archive creates and extracts tar streams, as they are exchanged by kubectl cp.
+package archive
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrOutsideRoot is returned for paths that are outside the root, either by their name or by following a symbolic link.
+var ErrOutsideRoot = errors.New("path is outside of the root")
+
+/*
+Create writes the file or directory at hostPath as a tar stream, like `tar cf - <name>`.
+The entries are named after name, which is the path of the file as it is seen by the caller.
+
+Paths whose parent directories resolve outside root are rejected. Symbolic links are archived as links,
+and they are not followed.
+*/
+func Create(w io.Writer, root string, hostPath string, name string) error {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return errors.Wrapf(err, "invalid root")
+	}
+
+	dir, err := filepath.EvalSymlinks(filepath.Dir(hostPath))
+	if err != nil {
+		return errors.Wrapf(err, "invalid path '%s'", name)
+	}
+
+	if err := checkWithin(root, dir); err != nil {
+		return errors.Wrapf(err, "invalid path '%s'", name)
+	}
+
+	hostPath = filepath.Join(dir, filepath.Base(hostPath))
+
+	tw := tar.NewWriter(w)
+
+	// tar strips the leading slash of absolute paths.
+	name = strings.TrimPrefix(path.Clean(name), "/")
+
+	err = filepath.Walk(hostPath, func(file string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(hostPath, file)
+		if err != nil {
+			return err
+		}
+
+		var link string
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = path.Join(name, filepath.ToSlash(rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to archive '%s'", name)
+	}
+
+	return tw.Close()
+}
+
+/*
+Extract writes the entries of a tar stream into dir, like `tar -xmf - -C <dir>`.
+
+Entries that would be written outside root, either by their name or by following a symbolic link,
+are rejected. The modification times of the entries are not restored.
+*/
+func Extract(r io.Reader, root string, dir string) error {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return errors.Wrapf(err, "invalid root")
+	}
+
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return errors.Wrapf(err, "invalid directory")
+	}
+
+	if err := checkWithin(root, dir); err != nil {
+		return errors.Wrapf(err, "invalid directory")
+	}
+
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "failed to read archive")
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+
+		if err := checkWithin(root, target); err != nil {
+			return errors.Wrapf(err, "invalid entry '%s'", hdr.Name)
+		}
+
+		parent, err := mkdirWithin(root, filepath.Dir(target))
+		if err != nil {
+			return errors.Wrapf(err, "invalid entry '%s'", hdr.Name)
+		}
+
+		target = filepath.Join(parent, filepath.Base(target))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+
+		case tar.TypeReg:
+			if err := extractFile(tr, target, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+
+		case tar.TypeSymlink:
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+
+		default:
+			// devices, fifos, and hard links are not copied by kubectl cp.
+			continue
+		}
+	}
+}
+
+func extractFile(r io.Reader, target string, perm fs.FileMode) error {
+	// do not write through an existing symbolic link.
+	if info, err := os.Lstat(target); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+// mkdirWithin creates the directory and its missing parents, and returns its resolved path.
+// Existing parents may be symbolic links, and therefore they are resolved before anything is created.
+func mkdirWithin(root string, dir string) (string, error) {
+	existing := dir
+
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+
+		existing = filepath.Dir(existing)
+	}
+
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkWithin(root, resolved); err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(existing, dir)
+	if err != nil {
+		return "", err
+	}
+
+	dir = filepath.Join(resolved, rel)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// checkWithin returns an error if the path is not within root.
+func checkWithin(root string, path string) error {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errors.Wrapf(ErrOutsideRoot, "'%s' is not within '%s'", path, root)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestCreateExtract(t *testing.T) {
+	src := t.TempDir()
+
+	mustWrite(t, filepath.Join(src, "data", "a.txt"), "a")
+	mustWrite(t, filepath.Join(src, "data", "sub", "b.txt"), "b")
+
+	if err := os.Symlink("a.txt", filepath.Join(src, "data", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := Create(&buf, src, filepath.Join(src, "data"), "/mnt/data"); err != nil {
+		t.Fatal(err)
+	}
+
+	/*-- the entries are named after the path in the container, like tar does --*/
+	var names []string
+
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+
+		names = append(names, hdr.Name)
+	}
+
+	sort.Strings(names)
+
+	want := []string{"mnt/data/", "mnt/data/a.txt", "mnt/data/link", "mnt/data/sub/", "mnt/data/sub/b.txt"}
+	if len(names) != len(want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("got %v, want %v", names, want)
+		}
+	}
+
+	/*-- extract into another directory --*/
+	dst := t.TempDir()
+
+	if err := Extract(bytes.NewReader(buf.Bytes()), dst, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := os.ReadFile(filepath.Join(dst, "mnt", "data", "sub", "b.txt")); err != nil || string(got) != "b" {
+		t.Errorf("unexpected content %q, err: '%v'", got, err)
+	}
+
+	if got, err := os.Readlink(filepath.Join(dst, "mnt", "data", "link")); err != nil || got != "a.txt" {
+		t.Errorf("unexpected link %q, err: '%v'", got, err)
+	}
+}
+
+func TestExtractOutsideRoot(t *testing.T) {
+	outside := t.TempDir()
+	root := t.TempDir()
+
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"by name":    "../evil.txt",
+		"by symlink": "escape/evil.txt",
+	}
+
+	for name, entry := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			tw := tar.NewWriter(&buf)
+			_ = tw.WriteHeader(&tar.Header{Name: entry, Typeflag: tar.TypeReg, Mode: 0o644, Size: 4})
+			_, _ = tw.Write([]byte("evil"))
+			_ = tw.Close()
+
+			if err := Extract(&buf, root, root); err == nil {
+				t.Error("expected the entry to be rejected")
+			}
+
+			if _, err := os.Stat(filepath.Join(outside, "evil.txt")); err == nil {
+				t.Error("the entry has been written outside the root")
+			}
+		})
+	}
+}
+
+func TestCreateOutsideRoot(t *testing.T) {
+	outside := t.TempDir()
+	root := t.TempDir()
+
+	mustWrite(t, filepath.Join(outside, "secret.txt"), "secret")
+
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"by name":    filepath.Join(root, "..", filepath.Base(outside), "secret.txt"),
+		"by symlink": filepath.Join(root, "escape", "secret.txt"),
+	}
+
+	for name, hostPath := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			if err := Create(&buf, root, hostPath, "/mnt/data/secret.txt"); !errors.Is(err, ErrOutsideRoot) {
+				t.Errorf("expected the path to be rejected, got '%v'", err)
+			}
+
+			if buf.Len() != 0 {
+				t.Error("the path has been archived from outside the root")
+			}
+		})
+	}
+}
+
+func mustWrite(t *testing.T, path string, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+CopyLogs copies the messages of CRI-formatted logs to the writers of their streams, until the source is drained,
+or until a writer fails (e.g, the client has disconnected). Lines that are not in the CRI format are copied to stdout.
+Streams without a writer are discarded.
+*/
+func CopyLogs(src io.Reader, stdout io.Writer, stderr io.Writer) error {
+	reader := bufio.NewReader(src)
+
+	for {
+		line, readErr := reader.ReadString('\n')
+
+		if len(line) > 0 {
+			out, msg := stdout, strings.TrimSuffix(line, "\n")+"\n"
+
+			if logLine, err := NewLogLine(strings.TrimSuffix(line, "\n")); err == nil {
+				msg = logLine.Msg
+
+				if !logLine.Partial() {
+					msg += "\n"
+				}
+
+				if logLine.Device == "stderr" {
+					out = stderr
+				}
+			}
+
+			if out != nil {
+				if _, err := io.WriteString(out, msg); err != nil {
+					return err
+				}
+			}
+		}
+
+		if readErr != nil {
+			if errors.Is(readErr, io.EOF) {
+				return nil
+			}
+
+			return readErr
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DecodeOptions select and format the lines of CRI-formatted container logs.
+type DecodeOptions struct {
+	// Since omits the lines that are logged before the given time.
+	Since time.Time
+
+	// Timestamps prefixes every line with its timestamp.
+	Timestamps bool
+
+	// LimitBytes truncates the output after the given number of bytes. Zero means no limit.
+	LimitBytes int64
+}
+
+// errLimitReached stops the decoding when the output has reached its limit.
+var errLimitReached = errors.New("limit of bytes has been reached")
+
+// limitedWriter writes up to the remaining bytes, and then fails with errLimitReached.
+type limitedWriter struct {
+	w         io.Writer
+	remaining int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) <= l.remaining {
+		n, err := l.w.Write(p)
+		l.remaining -= int64(n)
+
+		return n, err
+	}
+
+	n, err := l.w.Write(p[:l.remaining])
+	l.remaining -= int64(n)
+
+	if err != nil {
+		return n, err
+	}
+
+	return n, errLimitReached
+}
+
+// decodeReader closes both ends of the decoding.
+type decodeReader struct {
+	*io.PipeReader
+
+	src io.Closer
+}
+
+func (r *decodeReader) Close() error {
+	_ = r.src.Close()
+
+	return r.PipeReader.Close()
+}
+
+/*
+DecodeLogs returns the messages of CRI-formatted container logs (e.g, "<timestamp> <stream> <F|P> <message>"),
+as selected and formatted by the options. Lines that are not in the CRI format are passed as-is, and they
+are never omitted.
+
+Closing the returned reader closes the source as well.
+*/
+func DecodeLogs(src io.ReadCloser, opts DecodeOptions) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	var out io.Writer = pw
+	if opts.LimitBytes > 0 {
+		out = &limitedWriter{w: pw, remaining: opts.LimitBytes}
+	}
+
+	go func() {
+		defer src.Close()
+
+		reader := bufio.NewReader(src)
+		logOpts := LogOptions{Timestamps: opts.Timestamps}
+
+		for {
+			line, readErr := reader.ReadString('\n')
+
+			if len(line) > 0 {
+				if err := writeLogLine(out, strings.TrimSuffix(line, "\n"), opts.Since, &logOpts); err != nil {
+					if errors.Is(err, errLimitReached) {
+						err = nil
+					}
+
+					pw.CloseWithError(err)
+
+					return
+				}
+			}
+
+			if readErr != nil {
+				if errors.Is(readErr, io.EOF) {
+					readErr = nil
+				}
+
+				pw.CloseWithError(readErr)
+
+				return
+			}
+		}
+	}()
+
+	return &decodeReader{PipeReader: pr, src: src}
+}
+
+func writeLogLine(out io.Writer, line string, since time.Time, logOpts *LogOptions) error {
+	logLine, err := NewLogLine(line)
+	if err != nil {
+		// not in the CRI format (e.g, logs written by older versions of HPK).
+		_, err := io.WriteString(out, line+"\n")
+
+		return err
+	}
+
+	if !logLine.Since(since) {
+		return nil
+	}
+
+	msg := logLine.String(logOpts)
+	if !logLine.Partial() {
+		msg += "\n"
+	}
+
+	_, err = io.WriteString(out, msg)
+
+	return err
+}
+
+// LogMessage returns the message of a CRI-formatted log line, or the line as-is if it is not in the CRI format.
+func LogMessage(line string) string {
+	logLine, err := NewLogLine(line)
+	if err != nil {
+		return line
+	}
+
+	return logLine.Msg
+}
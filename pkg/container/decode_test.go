@@ -0,0 +1,105 @@
+package container
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeLogs(t *testing.T) {
+	logs := strings.Join([]string{
+		"2023-05-01T10:00:00.000000000Z stdout F first",
+		"2023-05-01T10:00:01.000000000Z stderr F second with  spaces",
+		"2023-05-01T10:00:02.000000000Z stdout P par",
+		"2023-05-01T10:00:02.100000000Z stdout F tial",
+		"not a cri line",
+	}, "\n") + "\n"
+
+	tests := []struct {
+		name string
+		opts DecodeOptions
+		want string
+	}{
+		{
+			name: "messages only",
+			opts: DecodeOptions{},
+			want: "first\nsecond with  spaces\npartial\nnot a cri line\n",
+		},
+		{
+			name: "since",
+			opts: DecodeOptions{Since: time.Date(2023, 5, 1, 10, 0, 1, 500, time.UTC)},
+			want: "partial\nnot a cri line\n",
+		},
+		{
+			name: "timestamps",
+			opts: DecodeOptions{Timestamps: true, Since: time.Date(2023, 5, 1, 10, 0, 1, 500, time.UTC)},
+			want: "2023-05-01T10:00:02.000000000Z par2023-05-01T10:00:02.100000000Z tial\nnot a cri line\n",
+		},
+		{
+			name: "limit bytes",
+			opts: DecodeOptions{LimitBytes: 8},
+			want: "first\nse",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded := DecodeLogs(io.NopCloser(strings.NewReader(logs)), tt.opts)
+			defer decoded.Close()
+
+			got, err := io.ReadAll(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogMessage(t *testing.T) {
+	if got := LogMessage("2023-05-01T10:00:00.000000000Z stdout F hello world"); got != "hello world" {
+		t.Errorf("got %q", got)
+	}
+
+	if got := LogMessage("raw line"); got != "raw line" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCopyLogs(t *testing.T) {
+	logs := strings.Join([]string{
+		"2023-05-01T10:00:00.000000000Z stdout F first",
+		"2023-05-01T10:00:01.000000000Z stderr F second",
+		"2023-05-01T10:00:02.000000000Z stdout P prompt> ",
+		"not a cri line",
+	}, "\n") + "\n"
+
+	var stdout, stderr strings.Builder
+
+	if err := CopyLogs(strings.NewReader(logs), &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "first\nprompt> not a cri line\n"; stdout.String() != want {
+		t.Errorf("stdout: got %q, want %q", stdout.String(), want)
+	}
+
+	if want := "second\n"; stderr.String() != want {
+		t.Errorf("stderr: got %q, want %q", stderr.String(), want)
+	}
+
+	// streams without a writer are discarded.
+	stdout.Reset()
+
+	if err := CopyLogs(strings.NewReader(logs), &stdout, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "first\nprompt> not a cri line\n"; stdout.String() != want {
+		t.Errorf("stdout: got %q, want %q", stdout.String(), want)
+	}
+}
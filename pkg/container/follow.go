@@ -0,0 +1,165 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/carv-ics-forth/hpk/pkg/filenotify"
+	"github.com/pkg/errors"
+)
+
+// followReader stops the streaming when the consumer closes the reader.
+type followReader struct {
+	*io.PipeReader
+
+	cancel context.CancelFunc
+}
+
+func (r *followReader) Close() error {
+	r.cancel()
+
+	return r.PipeReader.Close()
+}
+
+/*
+FollowFile streams the contents of a file that is being appended, starting at the given offset.
+
+The streaming is driven by the events of the watcher on the directories of the file and the doneFile,
+and therefore it works with both fs-event based and poll-based watchers. The file may not exist yet,
+and it may be rotated (i.e, renamed and replaced by a new file) while it is being streamed.
+The streaming stops when the context is cancelled, when the reader is closed,
+or when the doneFile appears and the remaining contents of the file are streamed.
+
+FollowFile takes the ownership of the watcher, and closes it when the streaming stops.
+*/
+func FollowFile(ctx context.Context, path string, offset int64, doneFile string, watcher filenotify.FileWatcher) (io.ReadCloser, error) {
+	for _, dir := range []string{filepath.Dir(path), filepath.Dir(doneFile)} {
+		if err := watcher.Add(dir); err != nil && !errors.Is(err, filenotify.ErrWatchExists) {
+			_ = watcher.Close()
+
+			return nil, errors.Wrapf(err, "failed to watch '%s'", dir)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+
+	go func() {
+		defer cancel()
+		defer watcher.Close()
+
+		var file *os.File
+
+		defer func() {
+			if file != nil {
+				file.Close()
+			}
+		}()
+
+		// drain copies any new contents of the file to the pipe.
+		var drain func() error
+
+		drain = func() error {
+			if file == nil {
+				f, err := os.Open(path)
+				if err != nil {
+					if errors.Is(err, os.ErrNotExist) {
+						return nil
+					}
+
+					return err
+				}
+
+				if _, err := f.Seek(offset, io.SeekStart); err != nil {
+					f.Close()
+
+					return err
+				}
+
+				file = f
+			}
+
+			if _, err := io.Copy(pw, file); err != nil {
+				return err
+			}
+
+			// the file has been rotated by the writer, so copy its last contents and continue with the new file.
+			if current, err := os.Stat(path); err == nil {
+				opened, err := file.Stat()
+				if err != nil {
+					return err
+				}
+
+				if !os.SameFile(current, opened) {
+					if _, err := io.Copy(pw, file); err != nil {
+						return err
+					}
+
+					file.Close()
+					file = nil
+					offset = 0
+
+					return drain()
+				}
+			}
+
+			return nil
+		}
+
+		for {
+			// check for completion before draining, so that no contents are lost between the two.
+			_, doneErr := os.Stat(doneFile)
+
+			if err := drain(); err != nil {
+				pw.CloseWithError(err)
+
+				return
+			}
+
+			if doneErr == nil {
+				pw.Close()
+
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				pw.CloseWithError(ctx.Err())
+
+				return
+
+			case _, ok := <-watcher.Events():
+				if !ok {
+					pw.CloseWithError(errors.New("watcher is closed"))
+
+					return
+				}
+
+			case err, ok := <-watcher.Errors():
+				if !ok || err != nil {
+					pw.CloseWithError(errors.Wrapf(err, "watcher has failed"))
+
+					return
+				}
+			}
+		}
+	}()
+
+	return &followReader{PipeReader: pr, cancel: cancel}, nil
+}
@@ -0,0 +1,187 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/carv-ics-forth/hpk/pkg/filenotify"
+)
+
+func TestFollowFile(t *testing.T) {
+	watchers := map[string]func() (filenotify.FileWatcher, error){
+		"poll":  func() (filenotify.FileWatcher, error) { return filenotify.New(10 * time.Millisecond) },
+		"event": func() (filenotify.FileWatcher, error) { return filenotify.New(0) },
+	}
+
+	for name, newWatcher := range watchers {
+		t.Run(name+"/until done", func(t *testing.T) {
+			dir := t.TempDir()
+			logPath := filepath.Join(dir, "logs", "main.logs")
+			donePath := filepath.Join(dir, "controlfiles", "main.exitCode")
+
+			mustMkdir(t, filepath.Dir(logPath), filepath.Dir(donePath))
+
+			if err := os.WriteFile(logPath, []byte("skipped\nfirst\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			watcher, err := newWatcher()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logs, err := FollowFile(context.Background(), logPath, int64(len("skipped\n")), donePath, watcher)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer logs.Close()
+
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				appendFile(t, logPath, "second\n")
+
+				time.Sleep(50 * time.Millisecond)
+				appendFile(t, logPath, "third\n")
+
+				if err := os.WriteFile(donePath, []byte("0"), 0o644); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			got, err := readWithTimeout(logs, 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := "first\nsecond\nthird\n"; got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+
+		t.Run(name+"/across rotation", func(t *testing.T) {
+			dir := t.TempDir()
+			logPath := filepath.Join(dir, "main.logs")
+			donePath := filepath.Join(dir, "main.exitCode")
+
+			if err := os.WriteFile(logPath, []byte("first\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			watcher, err := newWatcher()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logs, err := FollowFile(context.Background(), logPath, 0, donePath, watcher)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer logs.Close()
+
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				appendFile(t, logPath, "second\n")
+
+				if err := os.Rename(logPath, logPath+".1"); err != nil {
+					t.Error(err)
+				}
+
+				appendFile(t, logPath, "third\n")
+
+				time.Sleep(50 * time.Millisecond)
+
+				if err := os.WriteFile(donePath, []byte("0"), 0o644); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			got, err := readWithTimeout(logs, 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := "first\nsecond\nthird\n"; got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+
+		t.Run(name+"/until cancelled", func(t *testing.T) {
+			dir := t.TempDir()
+			logPath := filepath.Join(dir, "main.logs")
+			donePath := filepath.Join(dir, "main.exitCode")
+
+			watcher, err := newWatcher()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+
+			logs, err := FollowFile(ctx, logPath, 0, donePath, watcher)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer logs.Close()
+
+			go func() {
+				appendFile(t, logPath, "first\n")
+
+				time.Sleep(50 * time.Millisecond)
+				cancel()
+			}()
+
+			if _, err := readWithTimeout(logs, 5*time.Second); !errors.Is(err, context.Canceled) {
+				t.Errorf("expected the streaming to stop with a cancellation, got '%v'", err)
+			}
+		})
+	}
+}
+
+func mustMkdir(t *testing.T, dirs ...string) {
+	t.Helper()
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func appendFile(t *testing.T, path string, content string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(content); err != nil {
+		t.Error(err)
+	}
+}
+
+func readWithTimeout(r io.Reader, timeout time.Duration) (string, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		data, err := io.ReadAll(r)
+		done <- result{data: data, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return string(res.data), res.err
+	case <-time.After(timeout):
+		return "", context.DeadlineExceeded
+	}
+}
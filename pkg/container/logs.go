@@ -25,7 +25,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 const (
@@ -71,64 +71,58 @@ type LogLine struct {
 	ColorID      int64
 }
 
+// GetTailLog returns the last lines of the file, in chronological order.
 func GetTailLog(path string, tail int) ([]string, error) {
-	var (
-		nllCounter int
-		leftover   string
-		tailLog    []string
-	)
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+
 	rr, err := NewReverseReader(f)
 	if err != nil {
 		return nil, err
 	}
 
-	inputs := make(chan []string)
-	go func() {
-		for {
-			s, err := rr.Read()
-			if err != nil {
-				if errors.Is(err, io.EOF) {
-					inputs <- []string{leftover}
-				} else {
-					logrus.Error(err)
-				}
-				close(inputs)
-				if err := f.Close(); err != nil {
-					logrus.Error(err)
-				}
-				break
+	var (
+		leftover string
+		tailLog  []string
+	)
+
+	for len(tailLog) < tail {
+		s, err := rr.Read()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return nil, err
 			}
-			line := strings.Split(s+leftover, "\n")
-			if len(line) > 1 {
-				inputs <- line[1:]
+
+			// the beginning of the file has been reached
+			if len(leftover) > 0 {
+				tailLog = append(tailLog, leftover)
 			}
-			leftover = line[0]
+
+			break
 		}
-	}()
 
-	for i := range inputs {
-		// the incoming array is FIFO; we want FIFO so
-		// reverse the slice read order
-		for j := len(i) - 1; j >= 0; j-- {
+		line := strings.Split(s+leftover, "\n")
+		leftover = line[0]
+
+		// the page is read in reverse, so iterate from the last complete line.
+		for j := len(line) - 1; j > 0 && len(tailLog) < tail; j-- {
 			// lines that are "" are junk
-			if len(i[j]) < 1 {
+			if len(line[j]) < 1 {
 				continue
 			}
-			// read the content in reverse and add each nll until we have the same
-			// number of F type messages as the desired tail
-			tailLog = append(tailLog, i[j])
-			nllCounter++
-		}
-		// if we have enough log lines, we can hang up
-		if nllCounter >= tail {
-			break
+
+			tailLog = append(tailLog, line[j])
 		}
 	}
 
+	// restore the chronological order of the lines.
+	for i, j := 0, len(tailLog)-1; i < j; i, j = i+1, j-1 {
+		tailLog[i], tailLog[j] = tailLog[j], tailLog[i]
+	}
+
 	return tailLog, nil
 }
 
@@ -233,7 +227,7 @@ func (l *LogLine) Write(stdout io.Writer, stderr io.Writer, logOpts *LogOptions)
 		}
 	default:
 		// Warn the user if the device type does not match. Most likely the file is corrupted.
-		logrus.Warnf("Unknown Device type '%s' in log file from Container %s", l.Device, l.CID)
+		ctrllog.Log.WithName("container").Info("Unknown device type in log file", "device", l.Device, "containerID", l.CID)
 	}
 }
 
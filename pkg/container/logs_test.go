@@ -0,0 +1,67 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetTailLog(t *testing.T) {
+	// a log that spans multiple pages, so that the reverse reader has to stitch lines together.
+	var long []string
+	for i := 0; i < 2000; i++ {
+		long = append(long, strings.Repeat("x", i%7)+"line")
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		tail    int
+		want    []string
+	}{
+		{
+			name:    "fewer lines than tail",
+			content: "first\nsecond\n",
+			tail:    5,
+			want:    []string{"first", "second"},
+		},
+		{
+			name:    "more lines than tail",
+			content: "first\nsecond\nthird\n",
+			tail:    2,
+			want:    []string{"second", "third"},
+		},
+		{
+			name:    "no trailing newline",
+			content: "first\nsecond",
+			tail:    1,
+			want:    []string{"second"},
+		},
+		{
+			name:    "multiple pages",
+			content: strings.Join(long, "\n") + "\n",
+			tail:    3,
+			want:    long[len(long)-3:],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "container.logs")
+
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := GetTailLog(path, tt.tail)
+			if err != nil {
+				t.Fatalf("GetTailLog() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTailLog() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
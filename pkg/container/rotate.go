@@ -0,0 +1,194 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RotatedFiles returns the log file along with its rotated files (e.g, main.logs.2, main.logs.1, main.logs),
+// from the oldest to the newest. Files that do not exist are omitted.
+func RotatedFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list rotated files of '%s'", path)
+	}
+
+	type rotated struct {
+		path  string
+		index int
+	}
+
+	var files []rotated
+
+	for _, match := range matches {
+		index, err := strconv.Atoi(strings.TrimPrefix(match, path+"."))
+		if err != nil || index < 1 {
+			// not a rotated file (e.g, main.logs.tmp).
+			continue
+		}
+
+		files = append(files, rotated{path: match, index: index})
+	}
+
+	// the higher the index, the older the file.
+	sort.Slice(files, func(i, j int) bool { return files[i].index > files[j].index })
+
+	paths := make([]string, 0, len(files)+1)
+	for _, file := range files {
+		paths = append(paths, file.path)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// multiReadCloser closes all the underlying readers of a MultiReader.
+type multiReadCloser struct {
+	io.Reader
+
+	closers []io.Closer
+}
+
+func (m *multiReadCloser) Close() error {
+	var err error
+
+	for _, closer := range m.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// MultiReadCloser reads the readers one after the other, like io.MultiReader, and closes the closers upon Close.
+func MultiReadCloser(closers []io.Closer, readers ...io.Reader) io.ReadCloser {
+	return &multiReadCloser{Reader: io.MultiReader(readers...), closers: closers}
+}
+
+// OpenRotated opens the log file along with its rotated files, and reads them in chronological order.
+// If none of the files exists, it fails with os.ErrNotExist.
+func OpenRotated(path string) (io.ReadCloser, error) {
+	paths, err := RotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, errors.Wrapf(os.ErrNotExist, "no logs found at '%s'", path)
+	}
+
+	return OpenFiles(paths)
+}
+
+// OpenFiles opens the files, and reads them one after the other. Files that do not exist
+// (e.g, they have been rotated out in the meantime) are omitted.
+func OpenFiles(paths []string) (io.ReadCloser, error) {
+	var (
+		readers []io.Reader
+		closers []io.Closer
+	)
+
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			for _, closer := range closers {
+				closer.Close()
+			}
+
+			return nil, err
+		}
+
+		readers = append(readers, f)
+		closers = append(closers, f)
+	}
+
+	return MultiReadCloser(closers, readers...), nil
+}
+
+// GetRotatedTailLog returns the last lines of the log file, in chronological order.
+// If the file has fewer lines, the rest are taken from its rotated files.
+// If none of the files exists, it fails with os.ErrNotExist.
+func GetRotatedTailLog(path string, tail int) ([]string, error) {
+	paths, err := RotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, errors.Wrapf(os.ErrNotExist, "no logs found at '%s'", path)
+	}
+
+	var tailLog []string
+
+	// walk from the newest to the oldest file, until enough lines are collected.
+	for i := len(paths) - 1; i >= 0 && len(tailLog) < tail; i-- {
+		lines, err := GetTailLog(paths[i], tail-len(tailLog))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		tailLog = append(lines, tailLog...)
+	}
+
+	return tailLog, nil
+}
+
+// RenameRotated renames the log file along with its rotated files (e.g, main.logs.1 -> main.previous.logs.1).
+// Any rotated files of the destination are removed, so that they are not mixed with the renamed ones.
+func RenameRotated(oldPath, newPath string) error {
+	stale, err := RotatedFiles(newPath)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range stale {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(err, "failed to remove '%s'", p)
+		}
+	}
+
+	paths, err := RotatedFiles(oldPath)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		if err := os.Rename(p, newPath+strings.TrimPrefix(p, oldPath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(err, "failed to rename '%s'", p)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package container
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeRotated(t *testing.T, dir string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, "main.logs")
+
+	files := map[string]string{
+		path + ".2":   "first\nsecond\n",
+		path + ".1":   "third\n",
+		path:          "fourth\nfifth\n",
+		path + ".tmp": "ignored\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return path
+}
+
+func TestRotatedFiles(t *testing.T) {
+	path := writeRotated(t, t.TempDir())
+
+	got, err := RotatedFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{path + ".2", path + ".1", path}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestOpenRotated(t *testing.T) {
+	path := writeRotated(t, t.TempDir())
+
+	logs, err := OpenRotated(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logs.Close()
+
+	got, err := io.ReadAll(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "first\nsecond\nthird\nfourth\nfifth\n"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := OpenRotated(filepath.Join(t.TempDir(), "missing.logs")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist, got '%v'", err)
+	}
+}
+
+func TestGetRotatedTailLog(t *testing.T) {
+	path := writeRotated(t, t.TempDir())
+
+	tests := []struct {
+		tail int
+		want []string
+	}{
+		{tail: 1, want: []string{"fifth"}},
+		{tail: 3, want: []string{"third", "fourth", "fifth"}},
+		{tail: 10, want: []string{"first", "second", "third", "fourth", "fifth"}},
+	}
+
+	for _, tt := range tests {
+		got, err := GetRotatedTailLog(path, tt.tail)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tail %d: got %v, want %v", tt.tail, got, tt.want)
+		}
+	}
+}
+
+func TestRenameRotated(t *testing.T) {
+	dir := t.TempDir()
+	path := writeRotated(t, dir)
+	previous := filepath.Join(dir, "main.previous.logs")
+
+	// leftovers of an older run must not be mixed with the renamed logs.
+	if err := os.WriteFile(previous+".3", []byte("stale\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RenameRotated(path, previous); err != nil {
+		t.Fatal(err)
+	}
+
+	if paths, _ := RotatedFiles(path); len(paths) != 0 {
+		t.Errorf("expected no logs at the old path, got %v", paths)
+	}
+
+	got, err := RotatedFiles(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{previous + ".2", previous + ".1", previous}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
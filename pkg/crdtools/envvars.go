@@ -20,8 +20,8 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // FromEndpoints builds environment variables that a container is started with,
@@ -35,7 +35,7 @@ func FromEndpoints(endpoints []*corev1.Endpoints) []corev1.EnvVar {
 		subset := endpoint.Subsets[0]
 
 		if subset.Addresses == nil {
-			logrus.Warn("Ignoring subset ", subset.String())
+			ctrllog.Log.WithName("crdtools").Info("Ignoring subset without addresses", "subset", subset.String())
 
 			/*-- ignore addresses that are not ready --*/
 			continue
@@ -21,6 +21,15 @@ type FileWatcher interface {
 	Close() error
 }
 
+// New returns a poll-based file watcher if the interval is positive, or an fs-event based file watcher otherwise.
+func New(interval time.Duration) (FileWatcher, error) {
+	if interval > 0 {
+		return NewPollingWatcher(interval), nil
+	}
+
+	return NewEventWatcher()
+}
+
 // NewPollingWatcher returns a poll-based file watcher
 func NewPollingWatcher(interval time.Duration) FileWatcher {
 	return &filePoller{
@@ -0,0 +1,195 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging builds the logr.Logger of HPK, and routes the loggers of the libraries (klog, logrus) into it.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/klog/v2"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// DebugLevel is the verbosity of debug messages (e.g, logger.V(DebugLevel).Info(...)).
+const DebugLevel = 1
+
+/*
+New returns a logger that writes messages of at least the given level ("debug", "info", "warn", "error")
+in the given format ("text" or "json").
+Because logr has no warnings, "warn" keeps only the errors.
+*/
+func New(level string, format string) (logr.Logger, error) {
+	var zapLevel zapcore.Level
+
+	switch strings.ToLower(level) {
+	case "debug":
+		zapLevel = zapcore.DebugLevel
+	case "info", "":
+		zapLevel = zapcore.InfoLevel
+	case "warn", "warning":
+		zapLevel = zapcore.WarnLevel
+	case "error":
+		zapLevel = zapcore.ErrorLevel
+	default:
+		return logr.Logger{}, errors.Errorf("unknown log level '%s', expected one of debug, info, warn, error", level)
+	}
+
+	opts := []zap.Opts{
+		zap.Level(zapLevel),
+		zap.StacktraceLevel(zapcore.PanicLevel),
+		func(o *zap.Options) { o.TimeEncoder = zapcore.ISO8601TimeEncoder },
+	}
+
+	switch strings.ToLower(format) {
+	case FormatText, "":
+		opts = append(opts, zap.ConsoleEncoder())
+	case FormatJSON:
+		opts = append(opts, zap.JSONEncoder())
+	default:
+		return logr.Logger{}, errors.Errorf("unknown log format '%s', expected one of text, json", format)
+	}
+
+	return zap.New(opts...), nil
+}
+
+/*
+Install makes logger the sink of the libraries that log on their own: controller-runtime, klog
+(client-go, virtual-kubelet), and logrus.
+*/
+func Install(logger logr.Logger) {
+	ctrllog.SetLogger(logger)
+
+	klog.SetLogger(logger.WithName("klog"))
+
+	logrus.SetOutput(io.Discard)
+	logrus.SetLevel(logrus.TraceLevel)
+	logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+	logrus.AddHook(&logrusHook{logger: logger})
+}
+
+/*---------------------------------------------------
+ * Bridge for logrus
+ *---------------------------------------------------*/
+
+// logrusHook forwards the entries of logrus to logr.
+type logrusHook struct {
+	logger logr.Logger
+}
+
+func (h *logrusHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *logrusHook) Fire(entry *logrus.Entry) error {
+	keysAndValues := make([]interface{}, 0, 2*len(entry.Data))
+
+	var err error
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == logrus.ErrorKey {
+			err, _ = entry.Data[key].(error)
+
+			continue
+		}
+
+		keysAndValues = append(keysAndValues, key, entry.Data[key])
+	}
+
+	switch {
+	case entry.Level <= logrus.ErrorLevel:
+		h.logger.Error(err, entry.Message, keysAndValues...)
+	case entry.Level >= logrus.DebugLevel:
+		h.logger.V(DebugLevel).Info(entry.Message, keysAndValues...)
+	default:
+		h.logger.Info(entry.Message, keysAndValues...)
+	}
+
+	return nil
+}
+
+/*---------------------------------------------------
+ * Adapter for kubewebhook
+ *---------------------------------------------------*/
+
+// Webhook adapts logger to the logger of the admission webhooks.
+func Webhook(logger logr.Logger) kwhlog.Logger {
+	return webhookLogger{logger: logger}
+}
+
+type webhookLogger struct {
+	logger logr.Logger
+}
+
+func (l webhookLogger) Infof(format string, args ...interface{}) {
+	l.logger.Info(fmt.Sprintf(format, args...))
+}
+
+func (l webhookLogger) Warningf(format string, args ...interface{}) {
+	l.logger.Info(fmt.Sprintf(format, args...), "warning", true)
+}
+
+func (l webhookLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Error(nil, fmt.Sprintf(format, args...))
+}
+
+func (l webhookLogger) Debugf(format string, args ...interface{}) {
+	l.logger.V(DebugLevel).Info(fmt.Sprintf(format, args...))
+}
+
+func (l webhookLogger) WithValues(values map[string]interface{}) kwhlog.Logger {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	keysAndValues := make([]interface{}, 0, 2*len(values))
+	for _, key := range keys {
+		keysAndValues = append(keysAndValues, key, values[key])
+	}
+
+	return webhookLogger{logger: l.logger.WithValues(keysAndValues...)}
+}
+
+func (l webhookLogger) WithCtxValues(ctx context.Context) kwhlog.Logger {
+	return l.WithValues(kwhlog.ValuesFromCtx(ctx))
+}
+
+func (l webhookLogger) SetValuesOnCtx(parent context.Context, values map[string]interface{}) context.Context {
+	return kwhlog.CtxWithValues(parent, values)
+}
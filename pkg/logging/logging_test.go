@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestNew(t *testing.T) {
+	for _, level := range []string{"debug", "info", "warn", "error", ""} {
+		if _, err := New(level, FormatJSON); err != nil {
+			t.Errorf("unexpected error for level '%s': %v", level, err)
+		}
+	}
+
+	if _, err := New("verbose", FormatText); err == nil {
+		t.Error("expected error for unknown level")
+	}
+
+	if _, err := New("info", "xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestLogrusHook(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := zap.New(zap.WriteTo(&out), zap.JSONEncoder(), zap.Level(zapcore.InfoLevel))
+
+	entries := logrus.New()
+	entries.SetOutput(&bytes.Buffer{})
+	entries.SetLevel(logrus.TraceLevel)
+	entries.AddHook(&logrusHook{logger: logger})
+
+	entries.WithField("pod", "default/busybox").Info("hello")
+	entries.Debug("hidden")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %q", lines)
+	}
+
+	var line map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatal(err)
+	}
+
+	if line["msg"] != "hello" || line["pod"] != "default/busybox" {
+		t.Errorf("unexpected entry %v", line)
+	}
+}
+
+func TestWebhookLogger(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := Webhook(zap.New(zap.WriteTo(&out), zap.JSONEncoder()))
+	logger.WithValues(map[string]interface{}{"webhook": "pod-annotate"}).Infof("mutated %d pods", 1)
+
+	if !strings.Contains(out.String(), `"webhook":"pod-annotate"`) || !strings.Contains(out.String(), "mutated 1 pods") {
+		t.Errorf("unexpected output %s", out.String())
+	}
+}
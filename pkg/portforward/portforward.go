@@ -0,0 +1,300 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package portforward implements the server side of the port-forward protocol of the Kubelet.
+// Every forwarded connection is carried by a pair of streams (data and error) of a multiplexed SPDY connection.
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+)
+
+// ProtocolV1Name is the subprotocol used for port forwarding.
+const ProtocolV1Name = "portforward.k8s.io"
+
+// Forwarder copies the data between the stream and the port of the pod, until either side closes the connection.
+type Forwarder func(ctx context.Context, port int32, stream io.ReadWriteCloser) error
+
+/*
+ServePortForward upgrades the request to a multiplexed connection, and forwards every pair of streams
+that the client creates to the port in the headers of the streams.
+
+The connection is closed when it becomes idle for idleTimeout. Pairs of streams that are not completed within
+creationTimeout are rejected.
+*/
+func ServePortForward(w http.ResponseWriter, req *http.Request, forwarder Forwarder, idleTimeout time.Duration, creationTimeout time.Duration) {
+	if _, err := httpstream.Handshake(req, w, []string{ProtocolV1Name}); err != nil {
+		// the handshake has already written the error to the response.
+		return
+	}
+
+	streamChan := make(chan httpstream.Stream, 1)
+
+	upgrader := spdy.NewResponseUpgrader()
+
+	conn := upgrader.UpgradeResponse(w, req, func(stream httpstream.Stream, replySent <-chan struct{}) error {
+		if stream.Headers().Get(corev1.StreamType) == "" {
+			return errors.Errorf("'%s' header is required", corev1.StreamType)
+		}
+
+		if stream.Headers().Get(corev1.PortHeader) == "" {
+			return errors.Errorf("'%s' header is required", corev1.PortHeader)
+		}
+
+		streamChan <- stream
+
+		return nil
+	})
+	if conn == nil {
+		// the upgrader has already written the error to the response.
+		return
+	}
+	defer conn.Close()
+
+	conn.SetIdleTimeout(idleTimeout)
+
+	h := &handler{
+		ctx:             req.Context(),
+		conn:            conn,
+		forwarder:       forwarder,
+		pairs:           make(map[string]*streamPair),
+		creationTimeout: creationTimeout,
+	}
+
+	h.run(streamChan)
+}
+
+// handler pairs the streams of a connection, and forwards the completed pairs.
+type handler struct {
+	ctx       context.Context
+	conn      httpstream.Connection
+	forwarder Forwarder
+
+	lock            sync.Mutex
+	pairs           map[string]*streamPair
+	creationTimeout time.Duration
+}
+
+// streamPair is the data and error streams of a forwarded connection.
+type streamPair struct {
+	lock sync.Mutex
+
+	requestID   string
+	port        int32
+	dataStream  httpstream.Stream
+	errorStream httpstream.Stream
+	complete    chan struct{}
+}
+
+func (h *handler) run(streamChan <-chan httpstream.Stream) {
+	for {
+		select {
+		case <-h.conn.CloseChan():
+			return
+		case stream := <-streamChan:
+			requestID := requestID(stream)
+
+			pair, created := h.getPair(requestID)
+
+			if err := pair.add(stream); err != nil {
+				h.removePair(requestID)
+
+				_ = stream.Reset()
+
+				continue
+			}
+
+			if created {
+				go h.monitorPair(pair)
+			}
+
+			if pair.isComplete() {
+				close(pair.complete)
+
+				go h.forward(pair)
+			}
+		}
+	}
+}
+
+// getPair returns the pair of streams for the request, and whether it has been created by the call.
+func (h *handler) getPair(requestID string) (*streamPair, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if pair, ok := h.pairs[requestID]; ok {
+		return pair, false
+	}
+
+	pair := &streamPair{requestID: requestID, complete: make(chan struct{})}
+	h.pairs[requestID] = pair
+
+	return pair, true
+}
+
+func (h *handler) removePair(requestID string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	delete(h.pairs, requestID)
+}
+
+// monitorPair rejects the pair if it is not completed within the creation timeout.
+func (h *handler) monitorPair(pair *streamPair) {
+	select {
+	case <-pair.complete:
+	case <-time.After(h.creationTimeout):
+		pair.fail(errors.Errorf("timed out waiting for the streams of request %s", pair.requestID))
+		pair.reset()
+
+		h.removePair(pair.requestID)
+	case <-h.conn.CloseChan():
+		h.removePair(pair.requestID)
+	}
+}
+
+// forward copies the data between the data stream and the port, and reports any failure to the error stream.
+func (h *handler) forward(pair *streamPair) {
+	defer h.removePair(pair.requestID)
+	defer pair.dataStream.Close()
+	defer pair.errorStream.Close()
+
+	if err := h.forwarder(h.ctx, pair.port, pair.dataStream); err != nil {
+		pair.fail(errors.Wrapf(err, "error forwarding port %d to pod", pair.port))
+	}
+}
+
+func (p *streamPair) add(stream httpstream.Stream) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	port, err := strconv.ParseUint(stream.Headers().Get(corev1.PortHeader), 10, 16)
+	if err != nil || port == 0 {
+		return errors.Errorf("invalid port '%s'", stream.Headers().Get(corev1.PortHeader))
+	}
+
+	p.port = int32(port)
+
+	switch streamType := stream.Headers().Get(corev1.StreamType); streamType {
+	case corev1.StreamTypeData:
+		if p.dataStream != nil {
+			return errors.New("data stream already assigned")
+		}
+
+		p.dataStream = stream
+	case corev1.StreamTypeError:
+		if p.errorStream != nil {
+			return errors.New("error stream already assigned")
+		}
+
+		p.errorStream = stream
+	default:
+		return errors.Errorf("invalid stream type '%s'", streamType)
+	}
+
+	return nil
+}
+
+func (p *streamPair) isComplete() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.dataStream != nil && p.errorStream != nil
+}
+
+func (p *streamPair) fail(err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.errorStream != nil {
+		_, _ = fmt.Fprint(p.errorStream, err.Error())
+	}
+}
+
+func (p *streamPair) reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, stream := range []httpstream.Stream{p.dataStream, p.errorStream} {
+		if stream != nil {
+			_ = stream.Reset()
+		}
+	}
+}
+
+// requestID returns the identifier that pairs the streams of a forwarded connection.
+// Older clients do not transmit the identifier, but they create the error and data streams consecutively.
+func requestID(stream httpstream.Stream) string {
+	if id := stream.Headers().Get(corev1.PortForwardRequestIDHeader); id != "" {
+		return id
+	}
+
+	if stream.Headers().Get(corev1.StreamType) == corev1.StreamTypeData {
+		return strconv.Itoa(int(stream.Identifier()) - 2)
+	}
+
+	return strconv.Itoa(int(stream.Identifier()))
+}
+
+/*
+ForwardTo connects the stream to a TCP address, and copies the data in both directions until the remote
+side closes the connection, or until the context is cancelled.
+*/
+func ForwardTo(ctx context.Context, address string, stream io.ReadWriteCloser) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to '%s'", address)
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	go func() {
+		// propagate the end of the input, and let the remote side finish its response.
+		if _, err := io.Copy(conn, stream); err == nil {
+			if tcpConn, ok := conn.(*net.TCPConn); ok {
+				_ = tcpConn.CloseWrite()
+			}
+		}
+	}()
+
+	if _, err := io.Copy(stream, conn); err != nil && ctx.Err() == nil {
+		return errors.Wrapf(err, "failed to copy from '%s'", address)
+	}
+
+	return nil
+}
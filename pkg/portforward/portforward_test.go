@@ -0,0 +1,145 @@
+package portforward
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+	clientforward "k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+func TestServePortForward(t *testing.T) {
+	/*-- a local echo server stands in for the pod --*/
+	pod, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pod.Close()
+
+	go func() {
+		for {
+			conn, err := pod.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				_, _ = fmt.Fprintf(conn, "echo: %s", line)
+			}()
+		}
+	}()
+
+	podAddr := pod.Addr().(*net.TCPAddr)
+
+	/*-- the kubelet forwards the streams to the pod --*/
+	var requestedPort int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ServePortForward(w, req, func(ctx context.Context, port int32, stream io.ReadWriteCloser) error {
+			requestedPort = port
+
+			return ForwardTo(ctx, podAddr.String(), stream)
+		}, time.Minute, 10*time.Second)
+	}))
+	defer server.Close()
+
+	/*-- the client listens locally, like kubectl port-forward --*/
+	transport, upgrader, err := spdy.RoundTripperFor(&rest.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, serverURL)
+
+	stopChan, readyChan := make(chan struct{}), make(chan struct{})
+	defer close(stopChan)
+
+	forwarder, err := clientforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{"0:8080"},
+		stopChan, readyChan, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errChan := make(chan error, 1)
+
+	go func() {
+		errChan <- forwarder.ForwardPorts()
+	}()
+
+	select {
+	case <-readyChan:
+	case err := <-errChan:
+		t.Fatal(err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("port forwarding is not ready")
+	}
+
+	ports, err := forwarder.GetPorts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/*-- every local connection reaches the pod --*/
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", ports[0].Local))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fmt.Fprintf(conn, "hello %d\n", i); err != nil {
+			t.Fatal(err)
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+		got, err := io.ReadAll(conn)
+		conn.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := fmt.Sprintf("echo: hello %d\n", i); string(got) != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	if requestedPort != 8080 {
+		t.Errorf("expected the pod port 8080, got %d", requestedPort)
+	}
+}
+
+func TestForwardToUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	if err := ForwardTo(context.Background(), addr, server); err == nil || !strings.Contains(err.Error(), addr) {
+		t.Errorf("expected a connection error, got '%v'", err)
+	}
+}
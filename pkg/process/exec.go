@@ -23,31 +23,46 @@ package process
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
+
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 var GoEnviron []string // "MY_VAR=some_value"
 
+// logger is bound to the logger of HPK, once it is set.
+var logger = ctrllog.Log.WithName("process")
+
 // Execute runs system command and returns whole output also in case of error
 func Execute(command string, arguments ...string) (out []byte, err error) {
 	return ExecuteInDir("", command, arguments...)
 }
 
+// ExecuteContext runs system command like Execute, but the process is killed if the context is cancelled.
+func ExecuteContext(ctx context.Context, command string, arguments ...string) (out []byte, err error) {
+	return executeInDir(ctx, "", command, arguments...)
+}
+
 // ExecuteInDir runs system command and returns whole output also in case of error in a specific directory
 func ExecuteInDir(dir string, command string, arguments ...string) (out []byte, err error) {
-	cmd := exec.Command(command, arguments...)
+	return executeInDir(context.Background(), dir, command, arguments...)
+}
+
+func executeInDir(ctx context.Context, dir string, command string, arguments ...string) (out []byte, err error) {
+	cmd := exec.CommandContext(ctx, command, arguments...)
 	if dir != "" {
 		cmd.Dir = dir
 	}
 
 	cmd.Env = os.Environ()
 	cmd.Env = append(cmd.Env, GoEnviron...)
-	// print the command
-	fmt.Println("Running command: ", cmd.String())
+	// the arguments may carry secrets (e.g, registry credentials).
+	logger.V(1).Info("Running command", "command", CommandLine(command, arguments...), "dir", dir)
 
 	buffer := new(bytes.Buffer)
 	cmd.Stdout = buffer
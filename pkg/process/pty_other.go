@@ -0,0 +1,31 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package process
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+func openPTY() (ptmx *os.File, tty *os.File, err error) {
+	return nil, nil, errors.New("pseudo-terminals are supported only on linux")
+}
+
+func setTerminalSize(ptmx *os.File, size TerminalSize) error {
+	return errors.New("pseudo-terminals are supported only on linux")
+}
@@ -0,0 +1,157 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	utilexec "k8s.io/utils/exec"
+)
+
+// TerminalSize is the size of the terminal of an interactive process.
+type TerminalSize struct {
+	Width  uint16
+	Height uint16
+}
+
+// Streams connect a process to its caller.
+type Streams struct {
+	// Stdin, Stdout, Stderr are the standard streams of the process. Nil streams are not connected.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// TTY runs the process within a pseudo-terminal. Then, Stdout receives both the stdout and stderr of the process.
+	TTY bool
+
+	// Resize delivers the changes to the size of the terminal. It is used only with TTY.
+	Resize <-chan TerminalSize
+}
+
+/*
+ExecuteWithStreams runs a system command, and streams its stdin/stdout/stderr until the command completes.
+
+The process is killed when the context is cancelled. If the process exits with a non-zero code,
+the returned error implements k8s.io/utils/exec.ExitError, so that the code can be reported to the caller.
+*/
+func ExecuteWithStreams(ctx context.Context, streams Streams, command string, arguments ...string) error {
+	cmd := exec.CommandContext(ctx, command, arguments...)
+	cmd.Env = append(os.Environ(), GoEnviron...)
+
+	if streams.TTY {
+		return executeWithTTY(cmd, streams)
+	}
+
+	if streams.Stdin != nil {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return errors.Wrapf(err, "failed to connect stdin")
+		}
+
+		go func() {
+			_, _ = io.Copy(stdin, streams.Stdin)
+			_ = stdin.Close()
+		}()
+	}
+
+	cmd.Stdout = streams.Stdout
+	cmd.Stderr = streams.Stderr
+
+	return exitError(cmd.Run())
+}
+
+func executeWithTTY(cmd *exec.Cmd, streams Streams) error {
+	ptmx, tty, err := openPTY()
+	if err != nil {
+		return errors.Wrapf(err, "failed to allocate a pseudo-terminal")
+	}
+	defer ptmx.Close()
+
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+
+	// the terminal becomes the controlling terminal of a new session.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+
+	if err := cmd.Start(); err != nil {
+		tty.Close()
+
+		return errors.Wrapf(err, "failed to start process")
+	}
+
+	// the terminal is used only by the process.
+	tty.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case size, ok := <-streams.Resize:
+				if !ok {
+					return
+				}
+
+				_ = setTerminalSize(ptmx, size)
+			}
+		}
+	}()
+
+	if streams.Stdin != nil {
+		go func() {
+			_, _ = io.Copy(ptmx, streams.Stdin)
+		}()
+	}
+
+	var output sync.WaitGroup
+
+	if streams.Stdout != nil {
+		output.Add(1)
+
+		go func() {
+			defer output.Done()
+
+			// the read fails with EIO once the process has closed the terminal.
+			_, _ = io.Copy(streams.Stdout, ptmx)
+		}()
+	}
+
+	err = cmd.Wait()
+
+	output.Wait()
+
+	return exitError(err)
+}
+
+// exitError converts the exit errors of os/exec into errors that carry the exit code.
+func exitError(err error) error {
+	var exitErr *exec.ExitError
+
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return utilexec.CodeExitError{Err: err, Code: exitErr.ExitCode()}
+	}
+
+	return err
+}
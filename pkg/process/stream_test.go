@@ -0,0 +1,50 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	utilexec "k8s.io/utils/exec"
+)
+
+func TestExecuteWithStreams(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	err := ExecuteWithStreams(context.Background(), Streams{
+		Stdin:  strings.NewReader("hello"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}, "sh", "-c", "cat; echo oops >&2; exit 3")
+
+	var exitErr utilexec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 3 {
+		t.Fatalf("expected exit code 3, got '%v'", err)
+	}
+
+	if got := stdout.String(); got != "hello" {
+		t.Errorf("stdout: got %q", got)
+	}
+
+	if got := stderr.String(); got != "oops\n" {
+		t.Errorf("stderr: got %q", got)
+	}
+}
+
+func TestExecuteWithStreamsTTY(t *testing.T) {
+	var stdout bytes.Buffer
+
+	err := ExecuteWithStreams(context.Background(), Streams{
+		Stdout: &stdout,
+		TTY:    true,
+	}, "sh", "-c", "test -t 0 && test -t 1 && echo terminal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := stdout.String(); !strings.Contains(got, "terminal") {
+		t.Errorf("expected the process to run within a terminal, got %q", got)
+	}
+}
@@ -3,6 +3,8 @@ package provider
 import (
 	"context"
 
+	"github.com/carv-ics-forth/hpk/compute"
+	"github.com/carv-ics-forth/hpk/compute/image"
 	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
 	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
 	corev1 "k8s.io/api/core/v1"
@@ -57,6 +59,10 @@ func MutatePod(ctx context.Context, review *kwhmodel.AdmissionReview, obj metav1
 		}
 	}
 
+	if compute.Environment.RewritePodImages {
+		rewritePodImages(pod)
+	}
+
 	// Mutate our object with the required annotations.
 	if pod.Annotations == nil {
 		pod.Annotations = make(map[string]string)
@@ -66,3 +72,14 @@ func MutatePod(ctx context.Context, review *kwhmodel.AdmissionReview, obj metav1
 
 	return &kwhmutating.MutatorResult{MutatedObject: pod}, nil
 }
+
+// rewritePodImages replaces the images of the containers with the images that are actually pulled (see image.Rewrites).
+func rewritePodImages(pod *corev1.Pod) {
+	for i := range pod.Spec.InitContainers {
+		pod.Spec.InitContainers[i].Image, _ = image.Rewrites.RewriteName(pod.Spec.InitContainers[i].Image)
+	}
+
+	for i := range pod.Spec.Containers {
+		pod.Spec.Containers[i].Image, _ = image.Rewrites.RewriteName(pod.Spec.Containers[i].Image)
+	}
+}
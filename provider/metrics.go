@@ -0,0 +1,326 @@
+// Copyright © 2023 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// metricsScrapeTimeout bounds the time for building the stats summary on each scrape.
+const metricsScrapeTimeout = 30 * time.Second
+
+/************************************************************
+
+		Resource Metrics (/metrics/resource)
+
+************************************************************/
+
+// The metrics follow the resource metrics of the Kubelet, as they are scraped by metrics-server.
+// See https://github.com/kubernetes/kubernetes/blob/master/pkg/kubelet/metrics/collectors/resource_metrics.go
+var (
+	nodeCPUUsageDesc = prometheus.NewDesc("node_cpu_usage_seconds_total",
+		"Cumulative cpu time consumed by the node in core-seconds",
+		nil, nil)
+
+	nodeMemoryUsageDesc = prometheus.NewDesc("node_memory_working_set_bytes",
+		"Current working set of the node in bytes",
+		nil, nil)
+
+	podCPUUsageDesc = prometheus.NewDesc("pod_cpu_usage_seconds_total",
+		"Cumulative cpu time consumed by the pod in core-seconds",
+		[]string{"namespace", "pod"}, nil)
+
+	podMemoryUsageDesc = prometheus.NewDesc("pod_memory_working_set_bytes",
+		"Current working set of the pod in bytes",
+		[]string{"namespace", "pod"}, nil)
+
+	containerCPUUsageDesc = prometheus.NewDesc("container_cpu_usage_seconds_total",
+		"Cumulative cpu time consumed by the container in core-seconds",
+		[]string{"container", "namespace", "pod"}, nil)
+
+	containerMemoryUsageDesc = prometheus.NewDesc("container_memory_working_set_bytes",
+		"Current working set of the container in bytes",
+		[]string{"container", "namespace", "pod"}, nil)
+
+	containerStartTimeDesc = prometheus.NewDesc("container_start_time_seconds",
+		"Start time of the container since unix epoch in seconds",
+		[]string{"container", "namespace", "pod"}, nil)
+
+	resourceScrapeErrorDesc = prometheus.NewDesc("scrape_error",
+		"1 if there was an error while getting container metrics, 0 otherwise",
+		nil, nil)
+)
+
+// resourceMetricsCollector exposes the usage of pods and containers, as it is sampled by their jobs.
+type resourceMetricsCollector struct {
+	summary func() (*statsv1alpha1.Summary, error)
+	logger  logr.Logger
+}
+
+func (c *resourceMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nodeCPUUsageDesc
+	ch <- nodeMemoryUsageDesc
+	ch <- podCPUUsageDesc
+	ch <- podMemoryUsageDesc
+	ch <- containerCPUUsageDesc
+	ch <- containerMemoryUsageDesc
+	ch <- containerStartTimeDesc
+	ch <- resourceScrapeErrorDesc
+}
+
+func (c *resourceMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	summary, err := c.summary()
+	if err != nil {
+		c.logger.Error(err, "Failed to get the stats summary for the resource metrics")
+
+		ch <- prometheus.MustNewConstMetric(resourceScrapeErrorDesc, prometheus.GaugeValue, 1)
+
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(resourceScrapeErrorDesc, prometheus.GaugeValue, 0)
+
+	collectCPU(ch, nodeCPUUsageDesc, summary.Node.CPU)
+	collectMemory(ch, nodeMemoryUsageDesc, summary.Node.Memory)
+
+	for _, pod := range summary.Pods {
+		namespace, name := pod.PodRef.Namespace, pod.PodRef.Name
+
+		collectCPU(ch, podCPUUsageDesc, pod.CPU, namespace, name)
+		collectMemory(ch, podMemoryUsageDesc, pod.Memory, namespace, name)
+
+		for _, container := range pod.Containers {
+			collectCPU(ch, containerCPUUsageDesc, container.CPU, container.Name, namespace, name)
+			collectMemory(ch, containerMemoryUsageDesc, container.Memory, container.Name, namespace, name)
+
+			collectStartTime(ch, containerStartTimeDesc, container.StartTime, container.Name, namespace, name)
+		}
+	}
+}
+
+/************************************************************
+
+		cAdvisor Metrics (/metrics/cadvisor)
+
+************************************************************/
+
+// The metrics are a subset of cAdvisor, with the labels that are set by the Kubelet.
+// Pod-level series have an empty container label, like the cgroup of the pod in cAdvisor.
+var (
+	cadvisorCPUUsageDesc = prometheus.NewDesc("container_cpu_usage_seconds_total",
+		"Cumulative cpu time consumed in seconds.",
+		[]string{"container", "namespace", "pod"}, nil)
+
+	cadvisorMemoryUsageDesc = prometheus.NewDesc("container_memory_usage_bytes",
+		"Current memory usage in bytes, including all memory regardless of when it was accessed",
+		[]string{"container", "namespace", "pod"}, nil)
+
+	cadvisorMemoryWorkingSetDesc = prometheus.NewDesc("container_memory_working_set_bytes",
+		"Current working set in bytes.",
+		[]string{"container", "namespace", "pod"}, nil)
+
+	cadvisorStartTimeDesc = prometheus.NewDesc("container_start_time_seconds",
+		"Start time of the container since unix epoch in seconds.",
+		[]string{"container", "namespace", "pod"}, nil)
+
+	cadvisorLastSeenDesc = prometheus.NewDesc("container_last_seen",
+		"Last time a container was seen by the exporter",
+		[]string{"container", "namespace", "pod"}, nil)
+
+	cadvisorNetworkRxBytesDesc = prometheus.NewDesc("container_network_receive_bytes_total",
+		"Cumulative count of bytes received",
+		[]string{"container", "interface", "namespace", "pod"}, nil)
+
+	cadvisorNetworkRxErrorsDesc = prometheus.NewDesc("container_network_receive_errors_total",
+		"Cumulative count of errors encountered while receiving",
+		[]string{"container", "interface", "namespace", "pod"}, nil)
+
+	cadvisorNetworkTxBytesDesc = prometheus.NewDesc("container_network_transmit_bytes_total",
+		"Cumulative count of bytes transmitted",
+		[]string{"container", "interface", "namespace", "pod"}, nil)
+
+	cadvisorNetworkTxErrorsDesc = prometheus.NewDesc("container_network_transmit_errors_total",
+		"Cumulative count of errors encountered while transmitting",
+		[]string{"container", "interface", "namespace", "pod"}, nil)
+
+	cadvisorFsUsageDesc = prometheus.NewDesc("container_fs_usage_bytes",
+		"Number of bytes that are consumed by the container on this filesystem.",
+		[]string{"container", "namespace", "pod"}, nil)
+)
+
+// cadvisorCollector exposes the usage of pods and containers in the format of cAdvisor.
+type cadvisorCollector struct {
+	summary func() (*statsv1alpha1.Summary, error)
+	logger  logr.Logger
+}
+
+func (c *cadvisorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cadvisorCPUUsageDesc
+	ch <- cadvisorMemoryUsageDesc
+	ch <- cadvisorMemoryWorkingSetDesc
+	ch <- cadvisorStartTimeDesc
+	ch <- cadvisorLastSeenDesc
+	ch <- cadvisorNetworkRxBytesDesc
+	ch <- cadvisorNetworkRxErrorsDesc
+	ch <- cadvisorNetworkTxBytesDesc
+	ch <- cadvisorNetworkTxErrorsDesc
+	ch <- cadvisorFsUsageDesc
+}
+
+func (c *cadvisorCollector) Collect(ch chan<- prometheus.Metric) {
+	summary, err := c.summary()
+	if err != nil {
+		c.logger.Error(err, "Failed to get the stats summary for the cAdvisor metrics")
+
+		return
+	}
+
+	now := float64(time.Now().Unix())
+
+	for _, pod := range summary.Pods {
+		namespace, name := pod.PodRef.Namespace, pod.PodRef.Name
+
+		/*-- the cgroup of the pod --*/
+		collectCPU(ch, cadvisorCPUUsageDesc, pod.CPU, "", namespace, name)
+		collectMemory(ch, cadvisorMemoryWorkingSetDesc, pod.Memory, "", namespace, name)
+		collectMemoryUsage(ch, cadvisorMemoryUsageDesc, pod.Memory, "", namespace, name)
+
+		collectStartTime(ch, cadvisorStartTimeDesc, pod.StartTime, "", namespace, name)
+		ch <- prometheus.MustNewConstMetric(cadvisorLastSeenDesc, prometheus.GaugeValue, now, "", namespace, name)
+
+		if pod.EphemeralStorage != nil && pod.EphemeralStorage.UsedBytes != nil {
+			ch <- prometheus.MustNewConstMetric(cadvisorFsUsageDesc, prometheus.GaugeValue,
+				float64(*pod.EphemeralStorage.UsedBytes), "", namespace, name)
+		}
+
+		if pod.Network != nil {
+			collectNetwork(ch, pod.Network, namespace, name)
+		}
+
+		/*-- the containers of the pod --*/
+		for _, container := range pod.Containers {
+			collectCPU(ch, cadvisorCPUUsageDesc, container.CPU, container.Name, namespace, name)
+			collectMemory(ch, cadvisorMemoryWorkingSetDesc, container.Memory, container.Name, namespace, name)
+			collectMemoryUsage(ch, cadvisorMemoryUsageDesc, container.Memory, container.Name, namespace, name)
+
+			collectStartTime(ch, cadvisorStartTimeDesc, container.StartTime, container.Name, namespace, name)
+			ch <- prometheus.MustNewConstMetric(cadvisorLastSeenDesc, prometheus.GaugeValue, now, container.Name, namespace, name)
+
+			if container.Logs != nil && container.Logs.UsedBytes != nil {
+				ch <- prometheus.MustNewConstMetric(cadvisorFsUsageDesc, prometheus.GaugeValue,
+					float64(*container.Logs.UsedBytes), container.Name, namespace, name)
+			}
+		}
+	}
+}
+
+// collectNetwork reports the network usage at the pod level, like the sandbox of the pod in cAdvisor.
+func collectNetwork(ch chan<- prometheus.Metric, network *statsv1alpha1.NetworkStats, namespace string, pod string) {
+	iface := network.Name
+	if iface == "" {
+		// the pods share the network of the compute node.
+		iface = "host"
+	}
+
+	for desc, value := range map[*prometheus.Desc]*uint64{
+		cadvisorNetworkRxBytesDesc:  network.RxBytes,
+		cadvisorNetworkRxErrorsDesc: network.RxErrors,
+		cadvisorNetworkTxBytesDesc:  network.TxBytes,
+		cadvisorNetworkTxErrorsDesc: network.TxErrors,
+	} {
+		if value == nil {
+			continue
+		}
+
+		ch <- prometheus.NewMetricWithTimestamp(network.Time.Time,
+			prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(*value), "", iface, namespace, pod))
+	}
+}
+
+/************************************************************
+
+		Helpers
+
+************************************************************/
+
+// ResourceMetricsHandler serves the resource metrics of the pods, like /metrics/resource of the Kubelet.
+func (v *VirtualK8S) ResourceMetricsHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&resourceMetricsCollector{summary: v.scrapeSummary, logger: v.Logger})
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+}
+
+// CadvisorMetricsHandler serves the usage of the pods, like /metrics/cadvisor of the Kubelet.
+func (v *VirtualK8S) CadvisorMetricsHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&cadvisorCollector{summary: v.scrapeSummary, logger: v.Logger})
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+}
+
+func (v *VirtualK8S) scrapeSummary() (*statsv1alpha1.Summary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsScrapeTimeout)
+	defer cancel()
+
+	return v.GetStatsSummary(ctx)
+}
+
+// collectCPU reports the cumulative CPU time, in seconds, at the time of the sample.
+func collectCPU(ch chan<- prometheus.Metric, desc *prometheus.Desc, stats *statsv1alpha1.CPUStats, labels ...string) {
+	if stats == nil || stats.UsageCoreNanoSeconds == nil {
+		return
+	}
+
+	ch <- prometheus.NewMetricWithTimestamp(stats.Time.Time,
+		prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(*stats.UsageCoreNanoSeconds)/float64(time.Second), labels...))
+}
+
+// collectMemory reports the working set, in bytes, at the time of the sample.
+func collectMemory(ch chan<- prometheus.Metric, desc *prometheus.Desc, stats *statsv1alpha1.MemoryStats, labels ...string) {
+	if stats == nil || stats.WorkingSetBytes == nil {
+		return
+	}
+
+	ch <- prometheus.NewMetricWithTimestamp(stats.Time.Time,
+		prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(*stats.WorkingSetBytes), labels...))
+}
+
+// collectMemoryUsage reports the memory usage, in bytes, at the time of the sample.
+func collectMemoryUsage(ch chan<- prometheus.Metric, desc *prometheus.Desc, stats *statsv1alpha1.MemoryStats, labels ...string) {
+	if stats == nil || stats.UsageBytes == nil {
+		return
+	}
+
+	ch <- prometheus.NewMetricWithTimestamp(stats.Time.Time,
+		prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(*stats.UsageBytes), labels...))
+}
+
+// collectStartTime reports the start time, in seconds since the epoch, if it is known.
+func collectStartTime(ch chan<- prometheus.Metric, desc *prometheus.Desc, startTime metav1.Time, labels ...string) {
+	if startTime.IsZero() {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(startTime.Unix()), labels...)
+}
@@ -16,7 +16,6 @@ package provider
 
 import (
 	"context"
-	"fmt"
 	"runtime"
 
 	"github.com/carv-ics-forth/hpk/compute/slurm"
@@ -156,7 +155,7 @@ func (v *VirtualK8S) NodeSystemInfo(_ context.Context) corev1.NodeSystemInfo {
 	// goinfo.GetInfo may crash sometimes. use this method to recover and continue.
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Println("Recovered from goinfo failure:", r)
+			v.Logger.Info("Recovered from goinfo failure", "panic", r)
 		}
 	}()
 
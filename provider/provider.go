@@ -19,6 +19,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -26,31 +27,44 @@ import (
 
 	"github.com/carv-ics-forth/hpk/compute/endpoint"
 	"github.com/carv-ics-forth/hpk/compute/events"
+	"github.com/carv-ics-forth/hpk/compute/metrics"
 	"github.com/carv-ics-forth/hpk/compute/podhandler"
 	"github.com/carv-ics-forth/hpk/compute/runtime"
-	"github.com/carv-ics-forth/hpk/compute/slurm"
 	"github.com/carv-ics-forth/hpk/pkg/container"
-	"github.com/sirupsen/logrus"
 	"github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
-	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/remotecommand"
 
 	"github.com/carv-ics-forth/hpk/compute"
 	"github.com/carv-ics-forth/hpk/pkg/filenotify"
+	"github.com/carv-ics-forth/hpk/pkg/process"
 	"github.com/go-logr/logr"
-	"github.com/niemeyer/pretty"
 	"github.com/pkg/errors"
 	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
 	vkapi "github.com/virtual-kubelet/virtual-kubelet/node/api"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/json"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// Pseudo-containers expose the files of the Slurm job via 'kubectl logs'. Because the API server accepts only the
+// containers of the pod spec, they are reached via the node proxy
+// (e.g, kubectl get --raw /api/v1/nodes/<node>/proxy/containerLogs/<namespace>/<pod>/hpk-stderr).
+// Containers of the pod with the same names take precedence.
+const (
+	// JobStdoutContainer returns the stdout of the Slurm job.
+	JobStdoutContainer = "hpk-stdout"
+
+	// JobStderrContainer returns the stderr of the Slurm job.
+	JobStderrContainer = "hpk-stderr"
+
+	// JobScriptContainer returns the script that is submitted to Slurm.
+	JobScriptContainer = "hpk-script"
 )
 
 // InitConfig is the config passed to initialize a registered provider.
 type InitConfig struct {
+	NodeName   string
 	InternalIP string
 	DaemonPort int32
 
@@ -69,21 +83,16 @@ type VirtualK8S struct {
 
 	fileWatcher filenotify.FileWatcher
 	updatedPod  func(*corev1.Pod)
+
+	startTime time.Time
 }
 
 // NewVirtualK8S reads a kubeconfig file and sets up a client to interact
 // with Slurm cluster. It is designed to restore missing state after a restart.
 func NewVirtualK8S(config InitConfig) (*VirtualK8S, error) {
-	var err error
-	var watcher filenotify.FileWatcher
-	logger := zap.New(zap.UseDevMode(true))
-
-	if config.FSPollingInterval > 0 {
-		watcher = filenotify.NewPollingWatcher(config.FSPollingInterval)
-	} else {
-		watcher, err = filenotify.NewEventWatcher()
-	}
+	logger := compute.DefaultLogger
 
+	watcher, err := filenotify.New(config.FSPollingInterval)
 	if err != nil {
 		return nil, errors.Wrapf(err, "add watcher on fsnotify failed")
 	}
@@ -95,6 +104,10 @@ func NewVirtualK8S(config InitConfig) (*VirtualK8S, error) {
 		return nil, errors.Wrapf(err, "Failed to initiaze HPK paths '%s'", compute.HPK.String())
 	}
 
+	if err := metrics.PersistSystemPanics(compute.HPK.SystemPanicsPath()); err != nil {
+		return nil, errors.Wrapf(err, "Failed to restore metrics")
+	}
+
 	/*---------------------------------------------------
 	 * Handle Corrupted Pods (With missing state)
 	 *---------------------------------------------------*/
@@ -155,13 +168,80 @@ func NewVirtualK8S(config InitConfig) (*VirtualK8S, error) {
 		return nil, errors.Wrapf(err, "failed to restore watchers")
 	}
 
+	metrics.SetPodCounter(countPodsPerPhase)
+
 	return &VirtualK8S{
 		InitConfig:  config,
 		Logger:      logger,
 		fileWatcher: watcher,
+		startTime:   time.Now(),
 	}, nil
 }
 
+// countPodsPerPhase counts the pods on the shared filesystem by phase. Pods that cannot be decoded are ignored.
+func countPodsPerPhase() map[string]int {
+	counts := make(map[string]int)
+
+	_ = compute.HPK.WalkPodDirectories(func(path endpoint.PodPath) error {
+		encodedPod, err := os.ReadFile(path.EncodedJSONPath())
+		if err != nil {
+			return nil
+		}
+
+		var pod corev1.Pod
+
+		if err := json.Unmarshal(encodedPod, &pod); err != nil {
+			return nil
+		}
+
+		phase := pod.Status.Phase
+		if phase == "" {
+			phase = corev1.PodPending
+		}
+
+		counts[string(phase)]++
+
+		return nil
+	})
+
+	return counts
+}
+
+// ImagesInUse returns the images of the pods on the shared filesystem, so that the garbage collector keeps them.
+func ImagesInUse() ([]string, error) {
+	var images []string
+
+	err := compute.HPK.WalkPodDirectories(func(path endpoint.PodPath) error {
+		encodedPod, err := os.ReadFile(path.EncodedJSONPath())
+		if err != nil {
+			// the pod has been deleted meanwhile.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+
+			return errors.Wrapf(err, "failed to read pod '%s'", path)
+		}
+
+		var pod corev1.Pod
+
+		if err := json.Unmarshal(encodedPod, &pod); err != nil {
+			return errors.Wrapf(err, "failed to decode pod '%s'", path)
+		}
+
+		for _, container := range pod.Spec.InitContainers {
+			images = append(images, container.Image)
+		}
+
+		for _, container := range pod.Spec.Containers {
+			images = append(images, container.Image)
+		}
+
+		return nil
+	})
+
+	return images, err
+}
+
 /************************************************************
 
 		Implements node.PodLifecycleHandler
@@ -178,7 +258,7 @@ core logic to be able to understand the type of failure.
 // CreatePod takes a Kubernetes Pod and deploys it within the provider.
 func (v *VirtualK8S) CreatePod(ctx context.Context, pod *corev1.Pod) error {
 	podKey := client.ObjectKeyFromObject(pod)
-	logger := v.Logger.WithValues("obj", podKey)
+	logger := v.Logger.WithValues("pod", podKey)
 
 	logger.Info("[K8s] -> CreatePod")
 
@@ -203,7 +283,11 @@ func (v *VirtualK8S) CreatePod(ctx context.Context, pod *corev1.Pod) error {
 	go func() {
 		// acknowledge the creation request and do the creation in the background.
 		// if the creation fails, the pod should be marked as failed and returned to the provider.
-		podhandler.CreatePod(ctx, pod, v.fileWatcher)
+		podhandler.CreatePod(ctx, pod, v.fileWatcher, func(pod *corev1.Pod) {
+			if v.updatedPod != nil {
+				v.updatedPod(pod)
+			}
+		})
 
 		v.updatedPod(pod)
 	}()
@@ -219,7 +303,7 @@ func (v *VirtualK8S) CreatePod(ctx context.Context, pod *corev1.Pod) error {
 // UpdatePod takes a Kubernetes Pod and updates it within the provider.
 func (v *VirtualK8S) UpdatePod(ctx context.Context, pod *corev1.Pod) error {
 	podKey := client.ObjectKeyFromObject(pod)
-	logger := v.Logger.WithValues("obj", podKey)
+	logger := v.Logger.WithValues("pod", podKey)
 
 	logger.Info("[K8s] -> UpdatePod",
 		"version", pod.GetResourceVersion(),
@@ -229,45 +313,38 @@ func (v *VirtualK8S) UpdatePod(ctx context.Context, pod *corev1.Pod) error {
 	defer logger.Info("[K8s] <- UpdatePod")
 
 	/*---------------------------------------------------
-	 * Ensure that received pod is newer than the local
+	 * Apply the changes to the local Pod
 	 *---------------------------------------------------*/
-	localPod, err := podhandler.LoadPodFromKey(podKey)
+	statusChanged, err := podhandler.UpdatePod(ctx, pod)
 	if err != nil {
-		return errdefs.NotFoundf("object not found")
-	}
-
-	if localPod.ResourceVersion >= pod.ResourceVersion {
-		// The received pod is old, so we can safely discard it
-		logger.Info("Discard update since its ResourceVersion is older than the local")
-
-		return nil
-	}
+		if errors.Is(err, fs.ErrNotExist) {
+			return errdefs.NotFoundf("object not found")
+		}
 
-	if !slurm.HasJobID(pod) {
-		// If the pod has not a received a job id, it means that it still being in the Slurm queue.
-		logger.Info("Discard update because job is still in the queue")
-		return nil
+		return errors.Wrapf(err, "failed to update pod '%s'", podKey)
 	}
 
 	/*---------------------------------------------------
-	 * Identify any intermediate actions that must taken
+	 * Propagate the new conditions to Kubernetes
 	 *---------------------------------------------------*/
-	if metaDiff := pretty.Diff(localPod.ObjectMeta.Annotations, pod.ObjectMeta.Annotations); len(metaDiff) > 0 {
-		/* ... */
-		logrus.Warn("DIFFERENCES ", metaDiff)
-	}
+	if statusChanged && v.updatedPod != nil {
+		localPod, err := podhandler.LoadPodFromKey(podKey)
+		if err != nil {
+			return errdefs.NotFoundf("object not found")
+		}
 
-	if specDiff := pretty.Diff(localPod.Spec, pod.Spec); len(specDiff) > 0 {
-		/* ... */
-	}
+		// the local status is refreshed from the runtime, as is done for the Slurm events.
+		podhandler.UpdateStatusFromRuntime(localPod)
 
-	if statusDiff := pretty.Diff(localPod.Status, pod.Status); len(statusDiff) > 0 {
-		/* ... */
-	}
+		if err := podhandler.SavePodStatus(ctx, localPod); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return errdefs.NotFoundf("object not found")
+			}
 
-	/*-- Update the local status of Pod --*/
-	if err := podhandler.SavePodToFile(ctx, pod); err != nil {
-		compute.SystemPanic(err, "failed to set job id for pod '%s'", podKey)
+			return errors.Wrapf(err, "failed to update pod '%s'", podKey)
+		}
+
+		v.updatedPod(localPod)
 	}
 
 	return nil
@@ -278,7 +355,7 @@ func (v *VirtualK8S) UpdatePod(ctx context.Context, pod *corev1.Pod) error {
 // state, as well as the pod. DeletePod may be called multiple times for the same pod.
 func (v *VirtualK8S) DeletePod(ctx context.Context, pod *corev1.Pod) error {
 	podKey := client.ObjectKeyFromObject(pod)
-	logger := v.Logger.WithValues("obj", podKey)
+	logger := v.Logger.WithValues("pod", podKey)
 
 	logger.Info("[K8s] -> DeletePod")
 
@@ -298,7 +375,7 @@ func (v *VirtualK8S) DeletePod(ctx context.Context, pod *corev1.Pod) error {
 // to return a version after DeepCopy.
 func (v *VirtualK8S) GetPod(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
 	podKey := client.ObjectKey{Namespace: namespace, Name: name}
-	logger := v.Logger.WithValues("obj", podKey)
+	logger := v.Logger.WithValues("pod", podKey)
 
 	logger.Info("[K8s] -> GetPod")
 
@@ -323,7 +400,7 @@ func (v *VirtualK8S) GetPod(ctx context.Context, namespace, name string) (*corev
 // to return a version after DeepCopy.
 func (v *VirtualK8S) GetPodStatus(ctx context.Context, namespace, name string) (*corev1.PodStatus, error) {
 	podKey := client.ObjectKey{Namespace: namespace, Name: name}
-	logger := v.Logger.WithValues("obj", podKey, "job")
+	logger := v.Logger.WithValues("pod", podKey)
 
 	logger.Info("[K8s] -> GetPodStatus")
 
@@ -410,6 +487,8 @@ func (v *VirtualK8S) NotifyPods(ctx context.Context, f func(*corev1.Pod)) {
 	go eh.Listen(ctx, events.PodControl{
 		UpdateStatus: podhandler.UpdateStatusFromRuntime,
 		LoadFromDisk: podhandler.LoadPodFromKey,
+		SaveStatus:   podhandler.SavePodStatus,
+		Resubmit:     podhandler.ResubmitPod,
 		NotifyVirtualKubelet: func(pod *corev1.Pod) {
 			if pod == nil {
 				panic("this should not happen")
@@ -442,7 +521,10 @@ func (v *VirtualK8S) NotifyPods(ctx context.Context, f func(*corev1.Pod)) {
 					return
 				}
 
-				panic(errors.Wrapf(err, "fsnotify failed"))
+				// errors concern single paths (e.g, a removed pod) or lost events, and the watcher keeps running.
+				v.Logger.Error(err, "File watcher has failed")
+
+				metrics.WatcherErrors.Inc()
 			}
 		}
 	}()
@@ -454,98 +536,213 @@ func (v *VirtualK8S) NotifyPods(ctx context.Context, f func(*corev1.Pod)) {
 
 ************************************************************/
 
-func (v *VirtualK8S) GetStatsSummary(context.Context) (*statsv1alpha1.Summary, error) {
+// GetStatsSummary gets the stats for the node, including running pods.
+// The node is virtual, and therefore its usage is the sum of the usage of its pods.
+func (v *VirtualK8S) GetStatsSummary(ctx context.Context) (*statsv1alpha1.Summary, error) {
 	v.Logger.Info("[K8s] -> GetStatsSummary")
 	defer v.Logger.Info("[K8s] <- GetStatsSummary")
 
-	panic("not yet supported")
+	pods, err := v.GetPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := metav1.Now()
+
+	var cpu, nanoCores, memory uint64
+
+	summary := &statsv1alpha1.Summary{
+		Node: statsv1alpha1.NodeStats{
+			NodeName:  v.NodeName,
+			StartTime: metav1.NewTime(v.startTime),
+		},
+	}
+
+	for _, pod := range pods {
+		podStats := podhandler.GetPodStats(pod)
+
+		if podStats.CPU != nil {
+			if podStats.CPU.UsageCoreNanoSeconds != nil {
+				cpu += *podStats.CPU.UsageCoreNanoSeconds
+			}
+
+			if podStats.CPU.UsageNanoCores != nil {
+				nanoCores += *podStats.CPU.UsageNanoCores
+			}
+		}
+
+		if podStats.Memory != nil && podStats.Memory.WorkingSetBytes != nil {
+			memory += *podStats.Memory.WorkingSetBytes
+		}
+
+		summary.Pods = append(summary.Pods, podStats)
+	}
+
+	summary.Node.CPU = &statsv1alpha1.CPUStats{Time: now, UsageCoreNanoSeconds: &cpu, UsageNanoCores: &nanoCores}
+	summary.Node.Memory = &statsv1alpha1.MemoryStats{Time: now, UsageBytes: &memory, WorkingSetBytes: &memory}
+
+	return summary, nil
 }
 
 // GetContainerLogs retrieves the logs of a container by name from the provider.
 func (v *VirtualK8S) GetContainerLogs(ctx context.Context, namespace, podName, containerName string, opts vkapi.ContainerLogOpts) (io.ReadCloser, error) {
 	podKey := client.ObjectKey{Namespace: namespace, Name: podName}
-	logger := v.Logger.WithValues("obj", podKey)
+	logger := v.Logger.WithValues("pod", podKey)
 
 	logger.Info("[K8s] -> GetContainerLogs", "container", containerName)
 	defer logger.Info("[K8s] <- GetContainerLogs", "container", containerName)
 
-	logfilePath := compute.HPK.Pod(podKey).Container(containerName).LogsPath()
+	/*---------------------------------------------------
+	 * Files of the Slurm Job
+	 *---------------------------------------------------*/
+	if jobFilePath, ok := jobFile(podKey, containerName); ok {
+		// the files are not in the CRI format, and they are not streamed.
+		logs, err := v.rawContainerLogs(ctx, jobFilePath, "", opts.Tail, false)
+		if err != nil {
+			return nil, err
+		}
+
+		return container.DecodeLogs(logs, container.DecodeOptions{LimitBytes: int64(opts.LimitBytes)}), nil
+	}
+
+	containerPath := compute.HPK.Pod(podKey).Container(containerName)
+	logfilePath := containerPath.LogsPath()
+
+	/*---------------------------------------------------
+	 * Logs of the Previous Run
+	 *---------------------------------------------------*/
+	if opts.Previous {
+		logfilePath = containerPath.PreviousLogsPath()
+
+		if paths, err := container.RotatedFiles(logfilePath); err != nil || len(paths) == 0 {
+			return nil, errdefs.NotFoundf("previous terminated container '%s' in pod '%s' not found", containerName, podKey)
+		}
+	}
 
+	/*---------------------------------------------------
+	 * Decoding options of the CRI-formatted logs
+	 *---------------------------------------------------*/
+	decodeOpts := container.DecodeOptions{
+		Timestamps: opts.Timestamps,
+		LimitBytes: int64(opts.LimitBytes),
+	}
+
+	switch {
+	case opts.SinceSeconds > 0:
+		decodeOpts.Since = time.Now().Add(-time.Duration(opts.SinceSeconds) * time.Second)
+	case !opts.SinceTime.IsZero():
+		decodeOpts.Since = opts.SinceTime
+	}
+
+	logs, err := v.rawContainerLogs(ctx, logfilePath, containerPath.ExitCodePath(), opts.Tail, opts.Follow && !opts.Previous)
+	if err != nil {
+		return nil, err
+	}
+
+	return container.DecodeLogs(logs, decodeOpts), nil
+}
+
+// jobFile returns the file of the Slurm job that is exposed by a pseudo-container, unless the pod has a container with the same name.
+func jobFile(podKey client.ObjectKey, containerName string) (string, bool) {
+	podPath := compute.HPK.Pod(podKey)
+
+	var path string
+
+	switch containerName {
+	case JobStdoutContainer:
+		path = podPath.StdoutPath()
+	case JobStderrContainer:
+		path = podPath.StderrPath()
+	case JobScriptContainer:
+		path = podPath.SubmitJobPath()
+	default:
+		return "", false
+	}
+
+	pod, err := podhandler.LoadPodFromKey(podKey)
+	if err != nil {
+		// the pod is gone, and the logs are not found anyway.
+		return path, true
+	}
+
+	for _, ctr := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		if ctr.Name == containerName {
+			return "", false
+		}
+	}
+
+	return path, true
+}
+
+// rawContainerLogs returns the logs of a container as written by the job, without any decoding.
+func (v *VirtualK8S) rawContainerLogs(ctx context.Context, logfilePath string, exitCodePath string, tail int, follow bool) (io.ReadCloser, error) {
 	/*---------------------------------------------------
 	 * Log Streaming (With Follow)
 	 *---------------------------------------------------*/
-	if opts.Follow {
-		// 	return io.NopCloser(strings.NewReader("Follow is not yet supported by HPK.\n")), nil
-		v.Logger.Info("[K8s] WARNING -- Log with \"follow\" is not yet supported by HPK")
-
-		/*
-			seek := tail.SeekInfo{
-				Offset: 0,
-				Whence: 0,
+	if follow {
+		// stream everything, or only the new contents after the requested tail.
+		var offset int64
+		var tailLogs []string
+
+		if tail > 0 {
+			if info, err := os.Stat(logfilePath); err == nil {
+				offset = info.Size()
+
+				tailLogs, err = container.GetRotatedTailLog(logfilePath, tail)
+				if err != nil {
+					return nil, errors.Wrapf(err, "unable to tail logs")
+				}
 			}
+		}
 
-			// whence 0=origin, 2=end
-			if opts.Tail >= 0 {
-				seek.Whence = 2
-			}
+		watcher, err := filenotify.New(v.FSPollingInterval)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to watch logs")
+		}
 
-			tailConfig := tail.Config{
-				MustExist: true,
-				Poll:      true,
-				Follow:    opts.Follow,
-				Location:  &seek,
-				DefaultLogger:    tail.DefaultLogger,
-				ReOpen:    opts.Follow,
-			}
+		logs, err := container.FollowFile(ctx, logfilePath, offset, exitCodePath, watcher)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to stream logs")
+		}
 
-			// tail the file and stream it to a pipe (that ends to a network socket).
-			t, err := tail.TailFile(logfilePath, tailConfig)
-			if err != nil {
-				return nil, errors.Wrapf(err, "unable to stream log file")
+		if tail > 0 {
+			results := bytes.NewBuffer(nil)
+
+			for _, nll := range tailLogs {
+				results.WriteString(nll + "\n")
 			}
 
-			pr, pw := io.Pipe()
+			return container.MultiReadCloser([]io.Closer{logs}, results, logs), nil
+		}
 
-			go func() {
-				defer pw.Close()
+		// stream everything, starting from the rotated logs.
+		paths, err := container.RotatedFiles(logfilePath)
+		if err != nil {
+			logs.Close()
 
-				var line *tail.Line
-				var ok bool
+			return nil, errors.Wrapf(err, "unable to list rotated logs")
+		}
 
-				for {
-					select {
-					case <-ctx.Done():
-						// the consumer has cancelled
-						t.Kill(errors.New("hangup by client"))
-						return
-					case line, ok = <-t.Lines:
-						if !ok {
-							// channel was closed
-							return
-						}
-					}
+		if len(paths) > 0 && paths[len(paths)-1] == logfilePath {
+			paths = paths[:len(paths)-1]
+		}
 
-					n, err := pw.Write([]byte(line.Text))
-					if err != nil {
-						panic("this should never happen:" + err.Error())
-					}
+		rotated, err := container.OpenFiles(paths)
+		if err != nil {
+			logs.Close()
 
-					// Unfortunately this pience of code does not seem to work
-					// because virtual kubelet does not support streaming.
-					// Nonethess, it stays here for further investigation.
-				}
-			}()
+			return nil, errors.Wrapf(err, "unable to open rotated logs")
+		}
 
-			return io.NopCloser(pr), nil
-		*/
+		return container.MultiReadCloser([]io.Closer{logs, rotated}, rotated, logs), nil
 	}
 
 	/*---------------------------------------------------
 	 * Log Batch (Without Follow)
 	 *---------------------------------------------------*/
-	if opts.Tail == 0 {
-		// return everything
-		logs, err := os.Open(logfilePath)
+	if tail == 0 {
+		// return everything, including the rotated logs
+		logs, err := container.OpenRotated(logfilePath)
 		if err != nil {
 			if errors.Is(err, os.ErrNotExist) {
 				// return an empty response instead of an error
@@ -558,30 +755,30 @@ func (v *VirtualK8S) GetContainerLogs(ctx context.Context, namespace, podName, c
 		return logs, nil
 	}
 
-	if opts.Tail > 0 {
-		logs, err := container.GetTailLog(logfilePath, opts.Tail)
-		if err != nil {
-			return nil, errors.Wrapf(err, "unable to batch logs")
+	logs, err := container.GetRotatedTailLog(logfilePath, tail)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// return an empty response instead of an error
+			return io.NopCloser(bytes.NewReader([]byte{})), nil
 		}
 
-		results := bytes.NewBuffer(nil)
+		return nil, errors.Wrapf(err, "unable to batch logs")
+	}
 
-		for _, nll := range logs {
-			results.WriteString(nll + "\n")
-		}
+	results := bytes.NewBuffer(nil)
 
-		return io.NopCloser(bytes.NewReader(results.Bytes())), nil
+	for _, nll := range logs {
+		results.WriteString(nll + "\n")
 	}
 
-	// return an empty response instead of an error
-	return io.NopCloser(bytes.NewReader([]byte{})), nil
+	return io.NopCloser(bytes.NewReader(results.Bytes())), nil
 }
 
 // RunInContainer executes a command in a container in the pod, copying data
 // between in/out/err and the container's stdin/stdout/stderr.
 func (v *VirtualK8S) RunInContainer(ctx context.Context, namespace, podName, containerName string, cmd []string, attach vkapi.AttachIO) error {
 	podKey := client.ObjectKey{Namespace: namespace, Name: podName}
-	logger := v.Logger.WithValues("obj", podKey)
+	logger := v.Logger.WithValues("pod", podKey)
 
 	/*---------------------------------------------------
 	 * Preamble used for Request tracing on the logs
@@ -598,47 +795,121 @@ func (v *VirtualK8S) RunInContainer(ctx context.Context, namespace, podName, con
 		}
 	}()
 
-	req := compute.K8SClientset.RESTClient().
-		Post().
-		Namespace(namespace).
-		Resource("pods").
-		Name(podName).
-		SubResource("exec").
-		Timeout(0).
-		VersionedParams(&corev1.PodExecOptions{
-			Container: containerName,
-			Command:   cmd,
-			Stdin:     attach.Stdin() != nil,
-			Stdout:    attach.Stdout() != nil,
-			Stderr:    attach.Stderr() != nil,
-			TTY:       attach.TTY(),
-		}, scheme.ParameterCodec)
-
-	exec, err := remotecommand.NewSPDYExecutor(v.InitConfig.RestConfig, "POST", req.URL())
+	err := podhandler.ExecInContainer(ctx, podKey, containerName, cmd, toStreams(ctx, attach))
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return errdefs.NotFound(err.Error())
+	case errors.Is(err, podhandler.ErrContainerNotRunning):
+		return errdefs.InvalidInput(err.Error())
+	default:
+		return err
+	}
+}
+
+// AttachToContainer attaches to the executing process of a container in the pod, copying data
+// between in/out/err and the container's stdin/stdout/stderr.
+func (v *VirtualK8S) AttachToContainer(ctx context.Context, namespace, podName, containerName string, attach vkapi.AttachIO) error {
+	podKey := client.ObjectKey{Namespace: namespace, Name: podName}
+	logger := v.Logger.WithValues("pod", podKey)
+
+	/*---------------------------------------------------
+	 * Preamble used for Request tracing on the logs
+	 *---------------------------------------------------*/
+	logger.Info("[K8s] -> AttachToContainer", "container", containerName)
+	defer logger.Info("[K8s] <- AttachToContainer", "container", containerName)
+
+	defer func() {
+		if attach.Stdout() != nil {
+			attach.Stdout().Close()
+		}
+		if attach.Stderr() != nil {
+			attach.Stderr().Close()
+		}
+	}()
+
+	watcher, err := filenotify.New(v.FSPollingInterval)
 	if err != nil {
-		return errors.Wrapf(err, "could not make remote command")
+		return errors.Wrapf(err, "unable to watch logs")
 	}
 
-	return exec.Stream(remotecommand.StreamOptions{
-		Stdin:             attach.Stdin(),
-		Stdout:            attach.Stdout(),
-		Stderr:            attach.Stderr(),
-		Tty:               attach.TTY(),
-		TerminalSizeQueue: &termSize{attach: attach},
-	})
+	err = podhandler.AttachToContainer(ctx, podKey, containerName, toStreams(ctx, attach), watcher)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return errdefs.NotFound(err.Error())
+	case errors.Is(err, podhandler.ErrContainerNotRunning):
+		return errdefs.InvalidInput(err.Error())
+	default:
+		return err
+	}
 }
 
-// termSize helps exec termSize
-type termSize struct {
-	attach vkapi.AttachIO
+// PortForward forwards a local port to a port on the pod.
+func (v *VirtualK8S) PortForward(ctx context.Context, namespace, podName string, port int32, stream io.ReadWriteCloser) error {
+	podKey := client.ObjectKey{Namespace: namespace, Name: podName}
+	logger := v.Logger.WithValues("pod", podKey)
+
+	/*---------------------------------------------------
+	 * Preamble used for Request tracing on the logs
+	 *---------------------------------------------------*/
+	logger.Info("[K8s] -> PortForward", "port", port)
+	defer logger.Info("[K8s] <- PortForward", "port", port)
+
+	err := podhandler.PortForward(ctx, podKey, port, stream)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return errdefs.NotFound(err.Error())
+	case errors.Is(err, podhandler.ErrContainerNotRunning):
+		return errdefs.InvalidInput(err.Error())
+	default:
+		return err
+	}
 }
 
-// Next returns the new terminal size after the terminal has been resized. It returns nil when
-// monitoring has been stopped.
-func (t *termSize) Next() *remotecommand.TerminalSize {
-	resize := <-t.attach.Resize()
-	return &remotecommand.TerminalSize{
-		Height: resize.Height,
-		Width:  resize.Width,
+// toStreams converts the streams of a remote command to the streams of a process.
+func toStreams(ctx context.Context, attach vkapi.AttachIO) process.Streams {
+	streams := process.Streams{
+		TTY: attach.TTY(),
+	}
+
+	// avoid typed nil interfaces for the streams that are not requested.
+	if attach.Stdin() != nil {
+		streams.Stdin = attach.Stdin()
+	}
+
+	if attach.Stdout() != nil {
+		streams.Stdout = attach.Stdout()
+	}
+
+	if attach.Stderr() != nil {
+		streams.Stderr = attach.Stderr()
+	}
+
+	if attach.TTY() {
+		resize := make(chan process.TerminalSize)
+		streams.Resize = resize
+
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case size, ok := <-attach.Resize():
+					if !ok {
+						return
+					}
+
+					select {
+					case resize <- process.TerminalSize{Width: size.Width, Height: size.Height}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
 	}
+
+	return streams
 }